@@ -25,11 +25,18 @@ The main command is called sql-migrate.
 	usage: sql-migrate [--version] [--help] <command> [<args>]
 
 	Available commands are:
+		apply     Apply a migration plan
 		down      Undo a database migration
+		goto      Migrates the database up or down to a target
+		lint      Check migrations for risky patterns
 		new       Create a new migration
+		plan      Create a migration plan to apply later
 		redo      Reapply the last migration
+		renumber  Renumber migrations to close gaps and resolve duplicates
+		squash    Squash old migrations into a single migration
 		status    Show migration status
 		up        Migrates the database to the most recent version available
+		validate  Check the migrations directory for mistakes
 
 Each command requires a configuration file (which defaults to dbconfig.yml, but can be specified with the -config flag). This config file should specify one or more environments:
 
@@ -0,0 +1,123 @@
+package migrate
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// Errors that can be matched with errors.Is. The errors returned by the
+// planning functions are a *PlanError wrapping one of these.
+var (
+	// ErrUnknownMigration means a migration was applied to the database, but
+	// isn't part of the migration source. See MigrationSet.IgnoreUnknown.
+	ErrUnknownMigration = errors.New("unknown migration in database")
+
+	// ErrVersionNotFound means no migration has the requested version.
+	ErrVersionNotFound = errors.New("unknown migration with version id")
+
+	// ErrAmbiguousVersion means several migrations have the requested version.
+	ErrAmbiguousVersion = errors.New("version is ambiguous")
+
+	// ErrTargetNotFound means no migration or point in time matches a target.
+	ErrTargetNotFound = errors.New("no migration or point in time matches the target")
+
+	// ErrPartiallySquashed means a squashed migration was applied, but not
+	// all of the migrations it replaces.
+	ErrPartiallySquashed = errors.New("has been applied, but not all migrations it squashes")
+
+	// ErrPlanOutOfDate means migrations were applied or reverted since a
+	// migration plan was created.
+	ErrPlanOutOfDate = errors.New("Migration plan is out of date")
+
+	// ErrPlanMismatch means a migration plan doesn't match the migrations
+	// anymore.
+	ErrPlanMismatch = errors.New("plan does not match the migration")
+
+	// ErrPendingMigration means a migration hasn't been applied yet, see
+	// StatusReport.Check.
+	ErrPendingMigration = errors.New("migration has not been applied")
+
+	// ErrOutOfOrder means a pending migration sorts before an applied one.
+	ErrOutOfOrder = errors.New("migration would be applied out of order")
+
+	// ErrMigrationChanged means a migration was changed after it was applied.
+	ErrMigrationChanged = errors.New("migration changed since it was applied")
+
+	// ErrIrreversible means an irreversible migration would be migrated down.
+	ErrIrreversible = errors.New("migration is irreversible")
+
+	// ErrEmptyDown means a migration without Down statements would be
+	// migrated down, see MigrationSet.EmptyDown.
+	ErrEmptyDown = errors.New("migration has no Down statements")
+)
+
+// ParseError is returned when a migration can't be parsed. It wraps the
+// error of the sqlparse package, which can be matched with its sentinel
+// errors.
+type ParseError struct {
+	Id  string
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("Error parsing migration (%s): %s", e.Id, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorCodeExtractor returns the error code of a database error of a driver,
+// and whether err is one.
+type ErrorCodeExtractor func(err error) (string, bool)
+
+var (
+	errorCodeExtractorsLock sync.RWMutex
+	errorCodeExtractors     []ErrorCodeExtractor
+)
+
+// RegisterErrorCodeExtractor adds a way to get the code of database errors,
+// for drivers DatabaseErrorCode doesn't know.
+func RegisterErrorCodeExtractor(extractor ErrorCodeExtractor) {
+	errorCodeExtractorsLock.Lock()
+	defer errorCodeExtractorsLock.Unlock()
+	errorCodeExtractors = append(errorCodeExtractors, extractor)
+}
+
+var oracleErrorRegex = regexp.MustCompile(`\bORA-\d{5}\b`)
+
+// DatabaseErrorCode returns the code of the database error in err, or "" when
+// it isn't known. That's the SQLSTATE for PostgreSQL (eg: 42P01), the error
+// number for SQL Server (eg: 208) and the ORA- code for Oracle (eg:
+// ORA-00942). Codes of other drivers need a RegisterErrorCodeExtractor.
+func DatabaseErrorCode(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	errorCodeExtractorsLock.RLock()
+	extractors := errorCodeExtractors
+	errorCodeExtractorsLock.RUnlock()
+	for _, extractor := range extractors {
+		if code, ok := extractor(err); ok {
+			return code
+		}
+	}
+
+	// Used by lib/pq and pgx.
+	var sqlState interface{ SQLState() string }
+	if errors.As(err, &sqlState) {
+		return sqlState.SQLState()
+	}
+
+	// Used by go-mssqldb.
+	var sqlServer interface{ SQLErrorNumber() int32 }
+	if errors.As(err, &sqlServer) {
+		return strconv.Itoa(int(sqlServer.SQLErrorNumber()))
+	}
+
+	return oracleErrorRegex.FindString(err.Error())
+}
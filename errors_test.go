@@ -0,0 +1,99 @@
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+
+	"github.com/rubenv/sql-migrate/sqlparse"
+)
+
+type ErrorsSuite struct {
+	Db *sql.DB
+}
+
+var _ = Suite(&ErrorsSuite{})
+
+func (s *ErrorsSuite) SetUpTest(c *C) {
+	var err error
+	s.Db, err = sql.Open("sqlite3", ":memory:")
+	c.Assert(err, IsNil)
+}
+
+func (s *ErrorsSuite) TestPlanErrors(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: sqliteMigrations[:2],
+	}
+
+	_, _, err := PlanMigrationToVersion(s.Db, "sqlite3", migrations, Up, 99)
+	c.Assert(errors.Is(err, ErrVersionNotFound), Equals, true)
+	c.Assert(err, ErrorMatches, ".*: unknown migration with version id 99 in database")
+	var planErr *PlanError
+	c.Assert(errors.As(err, &planErr), Equals, true)
+
+	_, _, _, err = PlanMigrationToTarget(s.Db, "sqlite3", migrations, "nope")
+	c.Assert(errors.Is(err, ErrTargetNotFound), Equals, true)
+
+	_, err = Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+
+	_, _, err = PlanMigration(s.Db, "sqlite3", &MemoryMigrationSource{Migrations: sqliteMigrations[:1]}, Up, 0)
+	c.Assert(errors.Is(err, ErrUnknownMigration), Equals, true)
+	c.Assert(errors.Is(err, ErrVersionNotFound), Equals, false)
+}
+
+func (s *ErrorsSuite) TestParseError(c *C) {
+	_, err := ParseMigration("1_broken.sql", strings.NewReader("-- +migrate Up\nSELECT 'a;\n"))
+	var parseErr *ParseError
+	c.Assert(errors.As(err, &parseErr), Equals, true)
+	c.Assert(parseErr.Id, Equals, "1_broken.sql")
+	c.Assert(errors.Is(err, sqlparse.ErrUnterminated), Equals, true)
+	c.Assert(err, ErrorMatches, `Error parsing migration \(1_broken.sql\): ERROR: unterminated string literal`)
+}
+
+func (s *ErrorsSuite) TestTxError(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{{Id: "1_fail.sql", Up: []string{"SELECT * FROM nope"}}},
+	}
+
+	_, err := Exec(s.Db, "sqlite3", migrations, Up)
+	var txErr *TxError
+	c.Assert(errors.As(err, &txErr), Equals, true)
+	c.Assert(errors.Unwrap(err), Equals, txErr.Err)
+}
+
+type sqlStateError struct{}
+
+func (sqlStateError) Error() string    { return "relation does not exist" }
+func (sqlStateError) SQLState() string { return "42P01" }
+
+type sqlServerError struct{}
+
+func (sqlServerError) Error() string         { return "Invalid object name" }
+func (sqlServerError) SQLErrorNumber() int32 { return 208 }
+
+type vendorError struct{ code int }
+
+func (e vendorError) Error() string { return "vendor error" }
+
+func (*ErrorsSuite) TestDatabaseErrorCode(c *C) {
+	c.Assert(DatabaseErrorCode(nil), Equals, "")
+	c.Assert(DatabaseErrorCode(errors.New("something")), Equals, "")
+	c.Assert(DatabaseErrorCode(fmt.Errorf("wrapped: %w", sqlStateError{})), Equals, "42P01")
+	c.Assert(DatabaseErrorCode(sqlServerError{}), Equals, "208")
+	c.Assert(DatabaseErrorCode(errors.New("ORA-00942: table or view does not exist")), Equals, "ORA-00942")
+
+	c.Assert(DatabaseErrorCode(vendorError{1146}), Equals, "")
+	RegisterErrorCodeExtractor(func(err error) (string, bool) {
+		var vendorErr vendorError
+		if errors.As(err, &vendorErr) {
+			return fmt.Sprint(vendorErr.code), true
+		}
+		return "", false
+	})
+	c.Assert(DatabaseErrorCode(vendorError{1146}), Equals, "1146")
+}
@@ -0,0 +1,92 @@
+package migrate
+
+import (
+	"context"
+
+	"github.com/rubenv/sql-migrate/sqlparse"
+)
+
+// Instrumentation is notified while migrations are applied, eg: to trace them
+// or to record metrics. Set it on a MigrationSet. The otelmigrate package
+// implements it with OpenTelemetry.
+//
+// Every Start call is followed by its End call, with the context the Start
+// call returned.
+type Instrumentation interface {
+	// StartRun is called before the planned migrations are applied. The
+	// returned context is passed to the calls for its migrations.
+	StartRun(ctx context.Context, run RunInfo) context.Context
+
+	// EndRun is called after the run, with the number of applied migrations
+	// and the error that stopped it.
+	EndRun(ctx context.Context, run RunInfo, applied int, err error)
+
+	// StartMigration is called before a migration is applied. The returned
+	// context is passed to the calls for its statements.
+	StartMigration(ctx context.Context, migration MigrationInfo) context.Context
+
+	// EndMigration is called after the migration was applied and recorded,
+	// or failed.
+	EndMigration(ctx context.Context, migration MigrationInfo, err error)
+
+	// StartStatement is called before a statement is executed. The returned
+	// context is used to execute it.
+	StartStatement(ctx context.Context, statement StatementInfo) context.Context
+
+	// EndStatement is called after the statement was executed, with the
+	// number of rows it affected, -1 when that isn't known.
+	EndStatement(ctx context.Context, statement StatementInfo, rowsAffected int64, err error)
+}
+
+// RunInfo describes a run of migrations for Instrumentation.
+type RunInfo struct {
+	Direction MigrationDirection
+
+	// Migrations is the number of planned migrations.
+	Migrations int
+}
+
+// MigrationInfo describes a migration for Instrumentation.
+type MigrationInfo struct {
+	Id        string
+	Direction MigrationDirection
+
+	// Transaction is set when the migration runs in a transaction.
+	Transaction bool
+}
+
+// StatementInfo describes a statement for Instrumentation.
+type StatementInfo struct {
+	MigrationId string
+	Direction   MigrationDirection
+
+	// Index is the index of the statement in the migration.
+	Index    int
+	Position sqlparse.StatementPosition
+}
+
+// Used when a MigrationSet has no Instrumentation.
+type noInstrumentation struct{}
+
+func (noInstrumentation) StartRun(ctx context.Context, _ RunInfo) context.Context { return ctx }
+
+func (noInstrumentation) EndRun(context.Context, RunInfo, int, error) {}
+
+func (noInstrumentation) StartMigration(ctx context.Context, _ MigrationInfo) context.Context {
+	return ctx
+}
+
+func (noInstrumentation) EndMigration(context.Context, MigrationInfo, error) {}
+
+func (noInstrumentation) StartStatement(ctx context.Context, _ StatementInfo) context.Context {
+	return ctx
+}
+
+func (noInstrumentation) EndStatement(context.Context, StatementInfo, int64, error) {}
+
+func (ms MigrationSet) instrumentation() Instrumentation {
+	if ms.Instrumentation == nil {
+		return noInstrumentation{}
+	}
+	return ms.Instrumentation
+}
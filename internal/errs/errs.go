@@ -0,0 +1,24 @@
+// Package errs holds error helpers shared by sql-migrate and sqlparse.
+package errs
+
+import "fmt"
+
+// An error with its own message, which matches a sentinel error with
+// errors.Is.
+type markedError struct {
+	sentinel error
+	err      error
+}
+
+func (e *markedError) Error() string { return e.err.Error() }
+
+func (e *markedError) Unwrap() []error { return []error{e.sentinel, e.err} }
+
+// Mark returns an error formatted like fmt.Errorf, which also matches
+// sentinel with errors.Is.
+func Mark(sentinel error, format string, args ...interface{}) error {
+	return &markedError{
+		sentinel: sentinel,
+		err:      fmt.Errorf(format, args...),
+	}
+}
@@ -3,22 +3,30 @@ package migrate
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"database/sql"
 	"embed"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"iter"
 	"net/http"
 	"os"
 	"path"
+	"reflect"
 	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/go-gorp/gorp/v3"
 
+	"github.com/rubenv/sql-migrate/internal/errs"
 	"github.com/rubenv/sql-migrate/sqlparse"
 )
 
@@ -29,6 +37,38 @@ const (
 	Down
 )
 
+func (d MigrationDirection) String() string {
+	switch d {
+	case Up:
+		return "up"
+	case Down:
+		return "down"
+	default:
+		return fmt.Sprintf("MigrationDirection(%d)", int(d))
+	}
+}
+
+func (d MigrationDirection) MarshalText() ([]byte, error) {
+	switch d {
+	case Up, Down:
+		return []byte(d.String()), nil
+	default:
+		return nil, fmt.Errorf("Unknown migration direction: %d", int(d))
+	}
+}
+
+func (d *MigrationDirection) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "up":
+		*d = Up
+	case "down":
+		*d = Down
+	default:
+		return fmt.Errorf("Unknown migration direction: %s", text)
+	}
+	return nil
+}
+
 // MigrationSet provides database parameters for a migration execution
 type MigrationSet struct {
 	// TableName name of the table used to store migration info.
@@ -40,12 +80,38 @@ type MigrationSet struct {
 	//
 	// This should be used sparingly as it is removing a safety check.
 	IgnoreUnknown bool
-	// DisableCreateTable disable the creation of the migration table
+	// DisableCreateTable disable the creation of the migration table. It's only
+	// created when applying migrations, reading a database without it
+	// behaves as if no migrations were applied.
 	DisableCreateTable bool
+	// RevertOrder is the order in which applied migrations are migrated down.
+	RevertOrder RevertOrder
+	// EmptyDown decides what happens when migrating down a migration without
+	// Down statements.
+	EmptyDown EmptyDownPolicy
+	// Warn, when set, is called with the warnings of EmptyDownWarn.
+	Warn func(error)
+	// Instrumentation, when set, is notified of the runs, migrations and
+	// statements that are applied, see the otelmigrate package.
+	Instrumentation Instrumentation
 }
 
 var migSet = MigrationSet{}
 
+// RevertOrder decides the order in which applied migrations are migrated
+// down.
+type RevertOrder int
+
+const (
+	// RevertById reverts the applied migrations with the highest Id first.
+	RevertById RevertOrder = iota
+
+	// RevertByAppliedAt reverts the most recently applied migrations first,
+	// undoing them in the opposite order of how they were applied. Migrations
+	// applied at the same time are reverted by Id.
+	RevertByAppliedAt
+)
+
 // NewMigrationSet returns a parametrized Migration object
 func (ms MigrationSet) getTableName() string {
 	if ms.TableName == "" {
@@ -54,6 +120,10 @@ func (ms MigrationSet) getTableName() string {
 	return ms.TableName
 }
 
+func (ms MigrationSet) getChecksumTableName() string {
+	return ms.getTableName() + "_checksums"
+}
+
 var numberPrefixRegex = regexp.MustCompile(`^(\d+).*$`)
 
 // PlanError happens where no migration plan could be created between the sets
@@ -62,12 +132,17 @@ var numberPrefixRegex = regexp.MustCompile(`^(\d+).*$`)
 type PlanError struct {
 	Migration    *Migration
 	ErrorMessage string
+
+	// Err is the cause, which can be matched with errors.Is, eg: against
+	// ErrUnknownMigration.
+	Err error
 }
 
-func newPlanError(migration *Migration, errorMessage string) error {
+func newPlanError(migration *Migration, err error) error {
 	return &PlanError{
 		Migration:    migration,
-		ErrorMessage: errorMessage,
+		ErrorMessage: err.Error(),
+		Err:          err,
 	}
 }
 
@@ -76,23 +151,81 @@ func (p *PlanError) Error() string {
 		p.Migration.Id, p.ErrorMessage)
 }
 
+func (p *PlanError) Unwrap() error {
+	return p.Err
+}
+
 // TxError is returned when any error is encountered during a database
 // transaction. It contains the relevant *Migration and notes it's Id in the
 // Error function output.
 type TxError struct {
 	Migration *Migration
 	Err       error
+
+	// StatementIndex is the index of the failing statement in the Up or Down
+	// statements of the migration, -1 when the error isn't caused by one of
+	// its statements.
+	StatementIndex int
+
+	// Position is where the failing statement is in the migration file, zero
+	// when it isn't known.
+	Position sqlparse.StatementPosition
+
+	// Statement is the failing statement, truncated to
+	// maxErrorStatementLength bytes.
+	Statement string
+
+	// Code is the code of the database error, see DatabaseErrorCode.
+	Code string
 }
 
+// The length failing statements are truncated to in TxError.
+const maxErrorStatementLength = 200
+
 func newTxError(migration *PlannedMigration, err error) error {
 	return &TxError{
-		Migration: migration.Migration,
-		Err:       err,
+		Migration:      migration.Migration,
+		Err:            err,
+		StatementIndex: -1,
+		Code:           DatabaseErrorCode(err),
+	}
+}
+
+func newStatementError(migration *PlannedMigration, index int, stmt sqlparse.Statement, err error) error {
+	return &TxError{
+		Migration:      migration.Migration,
+		Err:            err,
+		StatementIndex: index,
+		Position:       stmt.Position,
+		Statement:      truncateStatement(strings.TrimSpace(stmt.SQL), maxErrorStatementLength),
+		Code:           DatabaseErrorCode(err),
+	}
+}
+
+func truncateStatement(stmt string, length int) string {
+	if len(stmt) <= length {
+		return stmt
 	}
+	// Don't cut a multibyte character in half.
+	for length > 0 && !utf8.RuneStart(stmt[length]) {
+		length--
+	}
+	return stmt[:length] + "..."
+}
+
+func (e *TxError) Unwrap() error {
+	return e.Err
 }
 
 func (e *TxError) Error() string {
-	return e.Err.Error() + " handling " + e.Migration.Id
+	switch {
+	case e.Statement != "" && e.Position.StartLine > 0:
+		return fmt.Sprintf("%s handling %s (statement %d, line %d)", e.Err, e.Migration.Id, e.StatementIndex+1, e.Position.StartLine)
+	case e.Statement != "":
+		return fmt.Sprintf("%s handling %s (statement %d)", e.Err, e.Migration.Id, e.StatementIndex+1)
+	default:
+		return e.Err.Error() + " handling " + e.Migration.Id
+	}
 }
 
 // Set the name of the table used to store migration info.
@@ -116,6 +249,35 @@ func SetDisableCreateTable(disable bool) {
 	migSet.DisableCreateTable = disable
 }
 
+// EmptyDownPolicy decides what happens when migrating down a migration
+// without Down statements. Migrations marked as irreversible can't be
+// migrated down regardless.
+type EmptyDownPolicy int
+
+const (
+	// EmptyDownAllow removes the record of the migration without running
+	// anything.
+	EmptyDownAllow EmptyDownPolicy = iota
+
+	// EmptyDownWarn is like EmptyDownAllow, but passes an error matching
+	// ErrEmptyDown to MigrationSet.Warn.
+	EmptyDownWarn
+
+	// EmptyDownError makes planning fail with ErrEmptyDown.
+	EmptyDownError
+)
+
+// SetEmptyDownPolicy sets what happens when migrating down a migration without
+// Down statements.
+func SetEmptyDownPolicy(policy EmptyDownPolicy) {
+	migSet.EmptyDown = policy
+}
+
+// SetRevertOrder sets the order in which applied migrations are migrated down.
+func SetRevertOrder(order RevertOrder) {
+	migSet.RevertOrder = order
+}
+
 // SetIgnoreUnknown sets the flag that skips database check to see if there is a
 // migration in the database that is not in migration source.
 //
@@ -129,8 +291,36 @@ type Migration struct {
 	Up   []string
 	Down []string
 
+	// UpPositions and DownPositions hold the lines of each statement in Up
+	// and Down in the migration file, when the migration was parsed from one.
+	UpPositions   []sqlparse.StatementPosition
+	DownPositions []sqlparse.StatementPosition
+
+	// UpBlocks and DownBlocks tell which statements in Up and Down are
+	// PL/SQL blocks ended by a / separator, see sqlparse.Statement.Block.
+	UpBlocks   []bool
+	DownBlocks []bool
+
+	// Stream, when set, reads the statements from the migration file while
+	// they're executed, instead of holding them in Up and Down. See
+	// FSMigrationSource.StreamLargerThan.
+	Stream iter.Seq2[sqlparse.Statement, error]
+
+	// The number of statements in Stream, for Checksum.
+	streamUp, streamDown int
+
 	DisableTransactionUp   bool
 	DisableTransactionDown bool
+
+	// Squashes lists the Ids of the migrations this migration replaces, in
+	// the order they were applied. Having applied all of those is the same as
+	// having applied this migration.
+	Squashes []string
+
+	// Irreversible migrations can't be migrated down, planning to do so
+	// fails with ErrIrreversible. Set by a "-- +migrate Down irreversible"
+	// annotation.
+	Irreversible bool
 }
 
 func (m Migration) Less(other *Migration) bool {
@@ -147,22 +337,110 @@ func (m Migration) Less(other *Migration) bool {
 }
 
 func (m Migration) isNumeric() bool {
-	return len(m.NumberPrefixMatches()) > 0
+	_, err := m.Version()
+	return err == nil
 }
 
+// NumberPrefixMatches matches the number at the start of the file name of
+// the migration, ignoring the directories in its Id.
 func (m Migration) NumberPrefixMatches() []string {
-	return numberPrefixRegex.FindStringSubmatch(m.Id)
+	return numberPrefixRegex.FindStringSubmatch(path.Base(m.Id))
 }
 
+// VersionInt returns the numeric prefix of the migration Id.
+//
+// Panics if the Id does not start with a number, use Version to check.
 func (m Migration) VersionInt() int64 {
-	v := m.NumberPrefixMatches()[1]
-	value, err := strconv.ParseInt(v, 10, 64)
+	value, err := m.Version()
 	if err != nil {
-		panic(fmt.Sprintf("Could not parse %q into int64: %s", v, err))
+		panic(err.Error())
 	}
 	return value
 }
 
+// Version returns the numeric prefix of the migration Id, or an error if the
+// Id does not start with a number that fits in an int64.
+func (m Migration) Version() (int64, error) {
+	matches := m.NumberPrefixMatches()
+	if len(matches) == 0 {
+		return 0, fmt.Errorf("Migration %s has no numeric version", m.Id)
+	}
+	value, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Could not parse %q into int64: %w", matches[1], err)
+	}
+	return value, nil
+}
+
+// Checksum returns a hash of the statements and options of the migration,
+// which changes whenever the migration is edited.
+//
+// The checksum of a streamed migration is the same as when it's held in
+// memory, but computing it reads the migration file.
+func (m Migration) Checksum() string {
+	h := sha256.New()
+	upCount, downCount := len(m.Up), len(m.Down)
+	if m.Stream != nil {
+		upCount, downCount = m.streamUp, m.streamDown
+	}
+
+	_, _ = fmt.Fprintf(h, "up %t %d\n", m.DisableTransactionUp, upCount)
+	for stmt, err := range m.Statements(Up) {
+		if err != nil {
+			// Make sure it doesn't match any checksum.
+			_, _ = fmt.Fprintf(h, "error %s\n", err)
+			break
+		}
+		_, _ = fmt.Fprintf(h, "%d\n%s\n", len(stmt.SQL), stmt.SQL)
+	}
+	_, _ = fmt.Fprintf(h, "down %t %d\n", m.DisableTransactionDown, downCount)
+	for stmt, err := range m.Statements(Down) {
+		if err != nil {
+			_, _ = fmt.Fprintf(h, "error %s\n", err)
+			break
+		}
+		_, _ = fmt.Fprintf(h, "%d\n%s\n", len(stmt.SQL), stmt.SQL)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Statements returns the Up or Down statements of the migration, with their
+// position when it was parsed from a file. The statements of a streamed
+// migration are read from its file.
+func (m *Migration) Statements(dir MigrationDirection) iter.Seq2[sqlparse.Statement, error] {
+	if m.Stream != nil {
+		return func(yield func(sqlparse.Statement, error) bool) {
+			for stmt, err := range m.Stream {
+				if err == nil && stmt.Down != (dir == Down) {
+					continue
+				}
+				if !yield(stmt, err) || err != nil {
+					return
+				}
+			}
+		}
+	}
+
+	statements, positions, blocks := m.Up, m.UpPositions, m.UpBlocks
+	if dir == Down {
+		statements, positions, blocks = m.Down, m.DownPositions, m.DownBlocks
+	}
+	return func(yield func(sqlparse.Statement, error) bool) {
+		for i, sql := range statements {
+			stmt := sqlparse.Statement{SQL: sql, Down: dir == Down}
+			if len(positions) == len(statements) {
+				stmt.Position = positions[i]
+			}
+			if len(blocks) == len(statements) {
+				stmt.Block = blocks[i]
+			}
+			if !yield(stmt, nil) {
+				return
+			}
+		}
+	}
+}
+
 type PlannedMigration struct {
 	*Migration
 
@@ -170,6 +448,52 @@ type PlannedMigration struct {
 	Queries            []string
 }
 
+// Returns the statements to execute: the Queries, or the statements read
+// from the file of a streamed migration.
+func (m *PlannedMigration) statements(dir MigrationDirection) iter.Seq2[sqlparse.Statement, error] {
+	// The queries of a replayed plan can differ from the parsed ones.
+	if m.Stream != nil && len(m.Queries) == 0 || m.Stream == nil && slices.Equal(m.Queries, m.queries(dir)) {
+		return m.Migration.Statements(dir)
+	}
+
+	return func(yield func(sqlparse.Statement, error) bool) {
+		for _, sql := range m.Queries {
+			if !yield(sqlparse.Statement{SQL: sql, Down: dir == Down}, nil) {
+				return
+			}
+		}
+	}
+}
+
+func (m *Migration) queries(dir MigrationDirection) []string {
+	if dir == Down {
+		return m.Down
+	}
+	return m.Up
+}
+
+// Like queries, but reads the statements from the file of a streamed
+// migration.
+func (m *Migration) readQueries(dir MigrationDirection) ([]string, error) {
+	if m.Stream == nil {
+		return m.queries(dir), nil
+	}
+
+	var queries []string
+	for stmt, err := range m.Statements(dir) {
+		if err != nil {
+			return nil, err
+		}
+		queries = append(queries, stmt.SQL)
+	}
+	return queries, nil
+}
+
+// Whether the migration has Down statements, also when it is streamed.
+func (m *Migration) hasDown() bool {
+	return len(m.Down) > 0 || m.streamDown > 0
+}
+
 type byId []*Migration
 
 func (b byId) Len() int           { return len(b) }
@@ -181,6 +505,15 @@ type MigrationRecord struct {
 	AppliedAt time.Time `db:"applied_at"`
 }
 
+// The checksum of a migration when it was applied, to find migrations that
+// were changed afterwards. They're kept in a separate table, named after the
+// migration table with a _checksums suffix, so that older versions can still
+// read the migration table.
+type checksumRecord struct {
+	Id       string `db:"id"`
+	Checksum string `db:"checksum"`
+}
+
 type OracleDialect struct {
 	gorp.OracleDialect
 }
@@ -231,75 +564,402 @@ func (m MemoryMigrationSource) FindMigrations() ([]*Migration, error) {
 	return migrations, nil
 }
 
+// MigrationIdScheme decides the Id of a migration found in a subdirectory
+// when reading migrations recursively.
+type MigrationIdScheme int
+
+const (
+	// IdBaseName uses the name of the file as Id, like migrations at the top
+	// level. Files in different directories can't share a name.
+	IdBaseName MigrationIdScheme = iota
+
+	// IdRelativePath uses the path of the file relative to the root as Id,
+	// eg: 2024/1_initial.sql.
+	IdRelativePath
+)
+
 // A set of migrations loaded from an http.FileServer
 
 type HttpFileSystemMigrationSource struct {
 	FileSystem http.FileSystem
+
+	// Recursive also reads migrations from subdirectories. Directories whose
+	// name starts with "_" or "." are skipped.
+	Recursive bool
+
+	// IdScheme decides the Id of migrations in subdirectories.
+	IdScheme MigrationIdScheme
 }
 
 var _ MigrationSource = (*HttpFileSystemMigrationSource)(nil)
 
 func (f HttpFileSystemMigrationSource) FindMigrations() ([]*Migration, error) {
-	return findMigrations(f.FileSystem, "/")
+	return f.fsSource().FindMigrations()
+}
+
+func (f HttpFileSystemMigrationSource) fsSource() FSMigrationSource {
+	return FSMigrationSource{
+		FileSystem: httpFS{f.FileSystem},
+		Recursive:  f.Recursive,
+		IdScheme:   f.IdScheme,
+	}
 }
 
 // A set of migrations loaded from a directory.
 type FileMigrationSource struct {
 	Dir string
+
+	// Recursive also reads migrations from subdirectories. Directories whose
+	// name starts with "_" or "." are skipped.
+	Recursive bool
+
+	// IdScheme decides the Id of migrations in subdirectories.
+	IdScheme MigrationIdScheme
+
+	// ParseOptions configures how the files are split into statements,
+	// sqlparse.DefaultParseOptions() when nil.
+	ParseOptions *sqlparse.ParseOptions
+
+	// StreamLargerThan streams the migrations whose file is larger than this
+	// many bytes, see FSMigrationSource.
+	StreamLargerThan int64
 }
 
 var _ MigrationSource = (*FileMigrationSource)(nil)
 
 func (f FileMigrationSource) FindMigrations() ([]*Migration, error) {
-	filesystem := http.Dir(f.Dir)
-	return findMigrations(filesystem, "/")
+	return f.fsSource().FindMigrations()
+}
+
+// FindMigrationFiles returns the path of the file of each migration, relative
+// to Dir, by Id.
+func (f FileMigrationSource) FindMigrationFiles() (map[string]string, error) {
+	return f.fsSource().FindMigrationFiles()
+}
+
+func (f FileMigrationSource) fsSource() FSMigrationSource {
+	dir := f.Dir
+	if dir == "" {
+		dir = "."
+	}
+	return FSMigrationSource{
+		FileSystem:       os.DirFS(dir),
+		Recursive:        f.Recursive,
+		IdScheme:         f.IdScheme,
+		ParseOptions:     f.ParseOptions,
+		StreamLargerThan: f.StreamLargerThan,
+	}
+}
+
+// A set of migrations loaded from an io/fs filesystem, such as os.DirFS,
+// embed.FS or fstest.MapFS.
+type FSMigrationSource struct {
+	FileSystem fs.FS
+
+	// Root is the directory holding the migrations, the root of the
+	// filesystem when empty.
+	Root string
+
+	// Recursive also reads migrations from subdirectories. Directories whose
+	// name starts with "_" or "." are skipped.
+	Recursive bool
+
+	// IdScheme decides the Id of migrations in subdirectories.
+	IdScheme MigrationIdScheme
+
+	// Include and Exclude filter the files with path.Match patterns. Patterns
+	// with a "/" are matched against the path relative to Root, others against
+	// the file name. When Include is set, only files matching one of its
+	// patterns are read. Files matching one of the Exclude patterns are never
+	// read.
+	Include []string
+	Exclude []string
+
+	// ParseOptions configures how the files are split into statements,
+	// sqlparse.DefaultParseOptions() when nil.
+	ParseOptions *sqlparse.ParseOptions
+
+	// StreamLargerThan streams the migrations whose file is larger than this
+	// many bytes: their statements are read from the file while they're
+	// executed, so they don't have to fit in memory. The file is read once
+	// when the migration is found, to check it. Zero never streams.
+	StreamLargerThan int64
 }
 
-func findMigrations(dir http.FileSystem, root string) ([]*Migration, error) {
+var _ MigrationSource = (*FSMigrationSource)(nil)
+
+func (f FSMigrationSource) FindMigrations() ([]*Migration, error) {
 	migrations := make([]*Migration, 0)
 
-	file, err := dir.Open(root)
+	files, err := f.walk()
 	if err != nil {
 		return nil, err
 	}
 
-	files, err := file.Readdir(0)
+	paths := make(map[string]string)
+	for _, file := range files {
+		if !file.isMigration() {
+			continue
+		}
+		if other, ok := paths[file.Id]; ok {
+			return nil, fmt.Errorf("Duplicate migration id %s: %s and %s", file.Id, other, file.Rel)
+		}
+		paths[file.Id] = file.Rel
+
+		migration, err := f.migrationFromFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		migrations = append(migrations, migration)
+	}
+
+	// Make sure migrations are sorted
+	sort.Sort(byId(migrations))
+
+	return migrations, nil
+}
+
+// FindMigrationFiles returns the path of the file of each migration, relative
+// to Root, by Id.
+func (f FSMigrationSource) FindMigrationFiles() (map[string]string, error) {
+	files, err := f.walk()
 	if err != nil {
 		return nil, err
 	}
 
-	for _, info := range files {
-		if strings.HasSuffix(info.Name(), ".sql") {
-			migration, err := migrationFromFile(dir, root, info)
-			if err != nil {
-				return nil, err
+	paths := make(map[string]string)
+	for _, file := range files {
+		if file.isMigration() {
+			paths[file.Id] = file.Rel
+		}
+	}
+	return paths, nil
+}
+
+func (f FSMigrationSource) root() string {
+	// Paths in an fs.FS don't start with a slash, unlike in an http.FileSystem.
+	root := strings.TrimPrefix(f.Root, "/")
+	if root == "" {
+		return "."
+	}
+	return path.Clean(root)
+}
+
+type migrationFile struct {
+	Id string
+	// Path to open the file with, Rel is relative to the root.
+	Path string
+	Rel  string
+}
+
+func (f migrationFile) isMigration() bool {
+	return strings.HasSuffix(f.Path, ".sql")
+}
+
+// Lists the files in the root, and in its subdirectories when recursive,
+// sorted by path.
+func (f FSMigrationSource) walk() ([]migrationFile, error) {
+	var files []migrationFile
+
+	for _, pattern := range append(slices.Clone(f.Include), f.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("Invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	root := f.root()
+	err := fs.WalkDir(f.FileSystem, root, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			if name != root && (!f.Recursive || strings.HasPrefix(entry.Name(), "_") || strings.HasPrefix(entry.Name(), ".")) {
+				return fs.SkipDir
 			}
+			return nil
+		}
 
-			migrations = append(migrations, migration)
+		rel := strings.TrimPrefix(name, root+"/")
+		if root == "." {
+			rel = name
+		}
+
+		if !f.included(rel) {
+			return nil
+		}
+
+		id := entry.Name()
+		if f.IdScheme == IdRelativePath {
+			id = rel
 		}
+		files = append(files, migrationFile{
+			Id:   id,
+			Path: name,
+			Rel:  rel,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
+	return files, nil
+}
 
-	// Make sure migrations are sorted
-	sort.Sort(byId(migrations))
+func (f FSMigrationSource) included(rel string) bool {
+	match := func(patterns []string) bool {
+		for _, pattern := range patterns {
+			name := rel
+			if !strings.Contains(pattern, "/") {
+				name = path.Base(rel)
+			}
+			// The patterns were checked before walking.
+			if ok, _ := path.Match(pattern, name); ok {
+				return true
+			}
+		}
+		return false
+	}
 
-	return migrations, nil
+	if len(f.Include) > 0 && !match(f.Include) {
+		return false
+	}
+	return !match(f.Exclude)
 }
 
-func migrationFromFile(dir http.FileSystem, root string, info os.FileInfo) (*Migration, error) {
-	path := path.Join(root, info.Name())
-	file, err := dir.Open(path)
+func (f FSMigrationSource) migrationFromFile(file migrationFile) (*Migration, error) {
+	if f.StreamLargerThan > 0 {
+		info, err := fs.Stat(f.FileSystem, file.Path)
+		if err != nil {
+			return nil, fmt.Errorf("Error while opening %s: %w", file.Id, err)
+		}
+		if info.Size() > f.StreamLargerThan {
+			return f.streamedMigration(file)
+		}
+	}
+
+	content, err := fs.ReadFile(f.FileSystem, file.Path)
 	if err != nil {
-		return nil, fmt.Errorf("Error while opening %s: %w", info.Name(), err)
+		return nil, fmt.Errorf("Error while opening %s: %w", file.Id, err)
+	}
+
+	migration, err := ParseMigrationWithOptions(file.Id, bytes.NewReader(content), f.parseOptions())
+	if err != nil {
+		return nil, fmt.Errorf("Error while parsing %s: %w", file.Id, err)
+	}
+	return migration, nil
+}
+
+func (f FSMigrationSource) streamedMigration(file migrationFile) (*Migration, error) {
+	options := f.parseOptions()
+	migration := &Migration{
+		Id: file.Id,
+		Stream: func(yield func(sqlparse.Statement, error) bool) {
+			r, err := f.FileSystem.Open(file.Path)
+			if err != nil {
+				yield(sqlparse.Statement{}, fmt.Errorf("Error while opening %s: %w", file.Id, err))
+				return
+			}
+			defer r.Close()
+
+			_, statements := sqlparse.StreamMigration(r, options)
+			for stmt, err := range statements {
+				if err != nil {
+					err = &ParseError{Id: file.Id, Err: err}
+				}
+				if !yield(stmt, err) {
+					return
+				}
+			}
+		},
 	}
-	defer func() { _ = file.Close() }()
 
-	migration, err := ParseMigration(info.Name(), file)
+	// Read the migration once, for the annotations and to report errors
+	// before anything is executed.
+	r, err := f.FileSystem.Open(file.Path)
 	if err != nil {
-		return nil, fmt.Errorf("Error while parsing %s: %w", info.Name(), err)
+		return nil, fmt.Errorf("Error while opening %s: %w", file.Id, err)
+	}
+	defer r.Close()
+
+	parsed, statements := sqlparse.StreamMigration(r, options)
+	for stmt, err := range statements {
+		if err != nil {
+			return nil, fmt.Errorf("Error while parsing %s: %w", file.Id, &ParseError{Id: file.Id, Err: err})
+		}
+		if stmt.Down {
+			migration.streamDown++
+		} else {
+			migration.streamUp++
+		}
 	}
+
+	migration.DisableTransactionUp = parsed.DisableTransactionUp
+	migration.DisableTransactionDown = parsed.DisableTransactionDown
+	migration.Squashes = parsed.Squashes
+	migration.Irreversible = parsed.Irreversible
 	return migration, nil
 }
 
+func (f FSMigrationSource) parseOptions() sqlparse.ParseOptions {
+	options := sqlparse.DefaultParseOptions()
+	if f.ParseOptions != nil {
+		options = *f.ParseOptions
+	}
+	if options.Include == nil {
+		options.Include = IncludeFS(f.FileSystem, f.root())
+	}
+	return options
+}
+
+// IncludeFS returns a function for sqlparse.ParseOptions.Include that reads
+// the included files from root in the filesystem. Files outside of root can't
+// be included.
+func IncludeFS(fsys fs.FS, root string) func(name string) ([]byte, error) {
+	root = FSMigrationSource{Root: root}.root()
+	return func(name string) ([]byte, error) {
+		file := path.Join(root, name)
+		if !fs.ValidPath(file) || (root != "." && !strings.HasPrefix(file, root+"/")) {
+			return nil, fmt.Errorf("Invalid include path: %s", name)
+		}
+		return fs.ReadFile(fsys, file)
+	}
+}
+
+// Turns an http.FileSystem into an fs.FS.
+type httpFS struct {
+	fs http.FileSystem
+}
+
+func (h httpFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	path := "/" + name
+	if name == "." {
+		path = "/"
+	}
+	file, err := h.fs.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return httpFile{file}, nil
+}
+
+type httpFile struct {
+	http.File
+}
+
+func (f httpFile) ReadDir(count int) ([]fs.DirEntry, error) {
+	infos, err := f.Readdir(count)
+	entries := make([]fs.DirEntry, len(infos))
+	for i, info := range infos {
+		entries[i] = fs.FileInfoToDirEntry(info)
+	}
+	return entries, err
+}
+
 // Migrations from a bindata asset set.
 type AssetMigrationSource struct {
 	// Asset should return content of file in path if exists
@@ -349,12 +1009,28 @@ type EmbedFileSystemMigrationSource struct {
 	FileSystem embed.FS
 
 	Root string
+
+	// Recursive also reads migrations from subdirectories. Directories whose
+	// name starts with "_" or "." are skipped.
+	Recursive bool
+
+	// IdScheme decides the Id of migrations in subdirectories.
+	IdScheme MigrationIdScheme
 }
 
 var _ MigrationSource = (*EmbedFileSystemMigrationSource)(nil)
 
 func (f EmbedFileSystemMigrationSource) FindMigrations() ([]*Migration, error) {
-	return findMigrations(http.FS(f.FileSystem), f.Root)
+	return f.fsSource().FindMigrations()
+}
+
+func (f EmbedFileSystemMigrationSource) fsSource() FSMigrationSource {
+	return FSMigrationSource{
+		FileSystem: f.FileSystem,
+		Root:       f.Root,
+		Recursive:  f.Recursive,
+		IdScheme:   f.IdScheme,
+	}
 }
 
 // Avoids pulling in the packr library for everyone, mimicks the bits of
@@ -416,21 +1092,34 @@ func (p PackrMigrationSource) FindMigrations() ([]*Migration, error) {
 
 // Migration parsing
 func ParseMigration(id string, r io.ReadSeeker) (*Migration, error) {
+	return ParseMigrationWithOptions(id, r, sqlparse.DefaultParseOptions())
+}
+
+// ParseMigrationWithOptions parses a migration like ParseMigration, splitting
+// it into statements with the given options.
+func ParseMigrationWithOptions(id string, r io.ReadSeeker, options sqlparse.ParseOptions) (*Migration, error) {
 	m := &Migration{
 		Id: id,
 	}
 
-	parsed, err := sqlparse.ParseMigration(r)
+	parsed, err := sqlparse.ParseMigrationWithOptions(r, options)
 	if err != nil {
-		return nil, fmt.Errorf("Error parsing migration (%s): %w", id, err)
+		return nil, &ParseError{Id: id, Err: err}
 	}
 
 	m.Up = parsed.UpStatements
 	m.Down = parsed.DownStatements
+	m.UpPositions = parsed.UpPositions
+	m.DownPositions = parsed.DownPositions
+	m.UpBlocks = parsed.UpBlocks
+	m.DownBlocks = parsed.DownBlocks
 
 	m.DisableTransactionUp = parsed.DisableTransactionUp
 	m.DisableTransactionDown = parsed.DisableTransactionDown
 
+	m.Squashes = parsed.Squashes
+	m.Irreversible = parsed.Irreversible
+
 	return m, nil
 }
 
@@ -530,75 +1219,193 @@ func (ms MigrationSet) ExecVersionContext(ctx context.Context, db *sql.DB, diale
 	return ms.applyMigrations(ctx, dir, migrations, dbMap)
 }
 
-// Applies the planned migrations and returns the number of applied migrations.
-func (MigrationSet) applyMigrations(ctx context.Context, dir MigrationDirection, migrations []*PlannedMigration, dbMap *gorp.DbMap) (int, error) {
-	applied := 0
-	for _, migration := range migrations {
-		var executor SqlExecutor
-		var err error
+// Execute a set of migrations up or down to reach a target, see
+// PlanMigrationToTarget for the supported targets.
+//
+// Returns the number of applied migrations.
+func ExecTarget(db *sql.DB, dialect string, m MigrationSource, target string) (int, error) {
+	return migSet.ExecTargetContext(context.Background(), db, dialect, m, target)
+}
 
-		if migration.DisableTransaction {
-			executor = dbMap.WithContext(ctx)
-		} else {
-			e, err := dbMap.Begin()
-			if err != nil {
-				return applied, newTxError(migration, err)
+// Execute a set of migrations up or down to reach a target with an input context.
+//
+// Returns the number of applied migrations.
+func ExecTargetContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, target string) (int, error) {
+	return migSet.ExecTargetContext(ctx, db, dialect, m, target)
+}
+
+// Returns the number of applied migrations.
+func (ms MigrationSet) ExecTarget(db *sql.DB, dialect string, m MigrationSource, target string) (int, error) {
+	return ms.ExecTargetContext(context.Background(), db, dialect, m, target)
+}
+
+// Returns the number of applied migrations, but applies with an input context.
+func (ms MigrationSet) ExecTargetContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, target string) (int, error) {
+	migrations, dir, dbMap, err := ms.PlanMigrationToTarget(db, dialect, m, target)
+	if err != nil {
+		return 0, err
+	}
+	return ms.applyMigrations(ctx, dir, migrations, dbMap)
+}
+
+// Execute migrations planned by PlanMigration, PlanMigrationToVersion or
+// PlanMigrationToTarget, with the DbMap returned by the plan. Unlike Exec,
+// the migrations aren't planned again, so exactly the planned migrations run.
+//
+// Returns the number of applied migrations.
+func ExecPlanned(dbMap *gorp.DbMap, dir MigrationDirection, migrations []*PlannedMigration) (int, error) {
+	return migSet.ExecPlannedContext(context.Background(), dbMap, dir, migrations)
+}
+
+// Execute planned migrations with an input context, see ExecPlanned.
+//
+// Returns the number of applied migrations.
+func ExecPlannedContext(ctx context.Context, dbMap *gorp.DbMap, dir MigrationDirection, migrations []*PlannedMigration) (int, error) {
+	return migSet.ExecPlannedContext(ctx, dbMap, dir, migrations)
+}
+
+// Returns the number of applied migrations.
+func (ms MigrationSet) ExecPlanned(dbMap *gorp.DbMap, dir MigrationDirection, migrations []*PlannedMigration) (int, error) {
+	return ms.ExecPlannedContext(context.Background(), dbMap, dir, migrations)
+}
+
+// Returns the number of applied migrations, but applies with an input context.
+func (ms MigrationSet) ExecPlannedContext(ctx context.Context, dbMap *gorp.DbMap, dir MigrationDirection, migrations []*PlannedMigration) (int, error) {
+	return ms.applyMigrations(ctx, dir, migrations, dbMap)
+}
+
+// Applies the planned migrations and returns the number of applied migrations.
+func (ms MigrationSet) applyMigrations(ctx context.Context, dir MigrationDirection, migrations []*PlannedMigration, dbMap *gorp.DbMap) (applied int, err error) {
+	if err := ms.createTables(dbMap); err != nil {
+		return 0, err
+	}
+
+	instrumentation := ms.instrumentation()
+	run := RunInfo{Direction: dir, Migrations: len(migrations)}
+	ctx = instrumentation.StartRun(ctx, run)
+	defer func() { instrumentation.EndRun(ctx, run, applied, err) }()
+
+	for _, migration := range migrations {
+		if err := ms.applyMigration(ctx, dir, migration, dbMap); err != nil {
+			return applied, err
+		}
+
+		applied++
+	}
+
+	return applied, nil
+}
+
+// Applies a single planned migration and records it.
+func (ms MigrationSet) applyMigration(ctx context.Context, dir MigrationDirection, migration *PlannedMigration, dbMap *gorp.DbMap) (err error) {
+	instrumentation := ms.instrumentation()
+	info := MigrationInfo{Id: migration.Id, Direction: dir, Transaction: !migration.DisableTransaction}
+	ctx = instrumentation.StartMigration(ctx, info)
+	defer func() { instrumentation.EndMigration(ctx, info, err) }()
+
+	checksums := ms.hasChecksumTable(dbMap)
+
+	// executor runs the statements with the context of each statement.
+	var executor interface {
+		SqlExecutor
+		WithContext(ctx context.Context) gorp.SqlExecutor
+	}
+
+	if migration.DisableTransaction {
+		executor = dbMap
+	} else {
+		// The transaction is bound to ctx, so it's rolled back when ctx is
+		// canceled.
+		e, err := dbMap.WithContext(ctx).(*gorp.DbMap).Begin()
+		if err != nil {
+			return newTxError(migration, err)
+		}
+		executor = e
+	}
+
+	i := 0
+	for statement, err := range migration.statements(dir) {
+		if err != nil {
+			if trans, ok := executor.(*gorp.Transaction); ok {
+				_ = trans.Rollback()
 			}
-			executor = e.WithContext(ctx)
+
+			return newTxError(migration, err)
 		}
 
-		for _, stmt := range migration.Queries {
-			// remove the semicolon from stmt, fix ORA-00922 issue in database oracle
-			stmt = strings.TrimSuffix(stmt, "\n")
-			stmt = strings.TrimSuffix(stmt, " ")
+		// remove the semicolon from stmt, fix ORA-00922 issue in database oracle
+		// (a PL/SQL block needs its final semicolon though)
+		stmt := strings.TrimSuffix(statement.SQL, "\n")
+		stmt = strings.TrimSuffix(stmt, " ")
+		if !statement.Block {
 			stmt = strings.TrimSuffix(stmt, ";")
-			if _, err := executor.Exec(stmt); err != nil {
-				if trans, ok := executor.(*gorp.Transaction); ok {
-					_ = trans.Rollback()
-				}
+		}
 
-				return applied, newTxError(migration, err)
+		stmtInfo := StatementInfo{MigrationId: migration.Id, Direction: dir, Index: i, Position: statement.Position}
+		stmtCtx := instrumentation.StartStatement(ctx, stmtInfo)
+		result, err := executor.WithContext(stmtCtx).Exec(stmt)
+		rowsAffected := int64(-1)
+		if err == nil {
+			if n, err := result.RowsAffected(); err == nil {
+				rowsAffected = n
 			}
 		}
+		instrumentation.EndStatement(stmtCtx, stmtInfo, rowsAffected, err)
+		if err != nil {
+			if trans, ok := executor.(*gorp.Transaction); ok {
+				_ = trans.Rollback()
+			}
 
-		switch dir {
-		case Up:
-			err = executor.Insert(&MigrationRecord{
-				Id:        migration.Id,
-				AppliedAt: time.Now(),
-			})
-			if err != nil {
-				if trans, ok := executor.(*gorp.Transaction); ok {
-					_ = trans.Rollback()
-				}
+			return newStatementError(migration, i, statement, err)
+		}
+		i++
+	}
 
-				return applied, newTxError(migration, err)
+	recorder := executor.WithContext(ctx)
+	switch dir {
+	case Up:
+		err = recorder.Insert(&MigrationRecord{
+			Id:        migration.Id,
+			AppliedAt: time.Now(),
+		})
+		if err == nil && checksums {
+			err = recordChecksum(recorder, migration.Migration)
+		}
+		if err != nil {
+			if trans, ok := executor.(*gorp.Transaction); ok {
+				_ = trans.Rollback()
 			}
-		case Down:
-			_, err := executor.Delete(&MigrationRecord{
-				Id: migration.Id,
+
+			return newTxError(migration, err)
+		}
+	case Down:
+		// The records of squashed migrations stand in for this migration.
+		for _, id := range append([]string{migration.Id}, migration.Squashes...) {
+			_, err := recorder.Delete(&MigrationRecord{
+				Id: id,
 			})
+			if err == nil && checksums {
+				_, err = recorder.Delete(&checksumRecord{Id: id})
+			}
 			if err != nil {
 				if trans, ok := executor.(*gorp.Transaction); ok {
 					_ = trans.Rollback()
 				}
 
-				return applied, newTxError(migration, err)
+				return newTxError(migration, err)
 			}
-		default:
-			panic("Not possible")
 		}
+	default:
+		panic("Not possible")
+	}
 
-		if trans, ok := executor.(*gorp.Transaction); ok {
-			if err := trans.Commit(); err != nil {
-				return applied, newTxError(migration, err)
-			}
+	if trans, ok := executor.(*gorp.Transaction); ok {
+		if err := trans.Commit(); err != nil {
+			return newTxError(migration, err)
 		}
-
-		applied++
 	}
 
-	return applied, nil
+	return nil
 }
 
 // Plan a migration.
@@ -623,20 +1430,22 @@ func (ms MigrationSet) PlanMigrationToVersion(db *sql.DB, dialect string, m Migr
 
 // A common method to plan a migration.
 func (ms MigrationSet) planMigrationCommon(db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection, max int, version int64) ([]*PlannedMigration, *gorp.DbMap, error) {
-	dbMap, err := ms.getMigrationDbMap(db, dialect)
+	dbMap, migrations, migrationRecords, err := ms.findMigrationsAndRecords(db, dialect, m)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	migrations, err := m.FindMigrations()
+	result, err := ms.planMigrations(migrations, migrationRecords, dir, max, version)
 	if err != nil {
 		return nil, nil, err
 	}
+	return result, dbMap, nil
+}
 
-	var migrationRecords []MigrationRecord
-	_, err = dbMap.Select(&migrationRecords, fmt.Sprintf("SELECT * FROM %s", dbMap.Dialect.QuotedTableForQuery(ms.SchemaName, ms.getTableName())))
-	if err != nil {
-		return nil, nil, err
+// Plans the migrations to run, given the migrations that have been run before.
+func (ms MigrationSet) planMigrations(migrations []*Migration, migrationRecords []MigrationRecord, dir MigrationDirection, max int, version int64) ([]*PlannedMigration, error) {
+	if dir == Down {
+		return ms.planRevert(migrations, migrationRecords, max, version)
 	}
 
 	// Sort migrations that have been run by Id.
@@ -648,20 +1457,6 @@ func (ms MigrationSet) planMigrationCommon(db *sql.DB, dialect string, m Migrati
 	}
 	sort.Sort(byId(existingMigrations))
 
-	// Make sure all migrations in the database are among the found migrations which
-	// are to be applied.
-	if !ms.IgnoreUnknown {
-		migrationsSearch := make(map[string]struct{})
-		for _, migration := range migrations {
-			migrationsSearch[migration.Id] = struct{}{}
-		}
-		for _, existingMigration := range existingMigrations {
-			if _, ok := migrationsSearch[existingMigration.Id]; !ok {
-				return nil, nil, newPlanError(existingMigration, "unknown migration in database")
-			}
-		}
-	}
-
 	// Get last migration that was run
 	record := &Migration{}
 	if len(existingMigrations) > 0 {
@@ -683,9 +1478,10 @@ func (ms MigrationSet) planMigrationCommon(db *sql.DB, dialect string, m Migrati
 	if version >= 0 {
 		targetIndex := 0
 		for targetIndex < len(toApply) {
-			tempVersion := toApply[targetIndex].VersionInt()
-			if dir == Up && tempVersion > version || dir == Down && tempVersion < version {
-				return nil, nil, newPlanError(&Migration{}, fmt.Errorf("unknown migration with version id %d in database", version).Error())
+			tempVersion, err := toApply[targetIndex].Version()
+			if err != nil || tempVersion > version {
+				// Migrations without a version sort after all versioned ones.
+				return nil, newPlanError(&Migration{}, errs.Mark(ErrVersionNotFound, "unknown migration with version id %d in database", version))
 			}
 			if tempVersion == version {
 				toApplyCount = targetIndex + 1
@@ -694,29 +1490,339 @@ func (ms MigrationSet) planMigrationCommon(db *sql.DB, dialect string, m Migrati
 			targetIndex++
 		}
 		if targetIndex == len(toApply) {
-			return nil, nil, newPlanError(&Migration{}, fmt.Errorf("unknown migration with version id %d in database", version).Error())
+			return nil, newPlanError(&Migration{}, errs.Mark(ErrVersionNotFound, "unknown migration with version id %d in database", version))
 		}
 	} else if max > 0 && max < toApplyCount {
 		toApplyCount = max
 	}
 	for _, v := range toApply[0:toApplyCount] {
-		switch dir {
-		case Up:
-			result = append(result, &PlannedMigration{
-				Migration:          v,
-				Queries:            v.Up,
-				DisableTransaction: v.DisableTransactionUp,
+		result = append(result, &PlannedMigration{
+			Migration:          v,
+			Queries:            v.Up,
+			DisableTransaction: v.DisableTransactionUp,
+		})
+	}
+
+	return result, nil
+}
+
+// Plans migrating down the migrations that have been run before. Migrations
+// that were never applied, eg: holes left by merges, are left alone.
+//
+// When version is given, the migrations are migrated down up to and including
+// the applied migration with that version. Otherwise at most max migrations
+// are migrated down, pass 0 for no limit.
+func (ms MigrationSet) planRevert(migrations []*Migration, migrationRecords []MigrationRecord, max int, version int64) ([]*PlannedMigration, error) {
+	toRevert := appliedInRevertOrder(migrations, migrationRecords, ms.RevertOrder)
+
+	if version >= 0 {
+		// Everything reverted before the target, in the revert order, is
+		// reverted with it.
+		i := slices.IndexFunc(toRevert, func(migration *Migration) bool {
+			v, err := migration.Version()
+			return err == nil && v == version
+		})
+		if i < 0 {
+			return nil, newPlanError(&Migration{}, errs.Mark(ErrVersionNotFound, "unknown migration with version id %d in database", version))
+		}
+		toRevert = toRevert[:i+1]
+	} else if max > 0 && max < len(toRevert) {
+		toRevert = toRevert[:max]
+	}
+
+	result := make([]*PlannedMigration, 0, len(toRevert))
+	for _, migration := range toRevert {
+		planned, err := ms.planDown(migration)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, planned)
+	}
+	return result, nil
+}
+
+// Plans migrating a single migration down, checking it can be undone.
+func (ms MigrationSet) planDown(migration *Migration) (*PlannedMigration, error) {
+	if migration.Irreversible {
+		return nil, newPlanError(migration, ErrIrreversible)
+	}
+	if !migration.hasDown() {
+		switch ms.EmptyDown {
+		case EmptyDownError:
+			return nil, newPlanError(migration, ErrEmptyDown)
+		case EmptyDownWarn:
+			if ms.Warn != nil {
+				ms.Warn(fmt.Errorf("%s: %w", migration.Id, ErrEmptyDown))
+			}
+		}
+	}
+	return &PlannedMigration{
+		Migration:          migration,
+		Queries:            migration.Down,
+		DisableTransaction: migration.DisableTransactionDown,
+	}, nil
+}
+
+// Returns the migrations that have a record, in the order in which they should
+// be migrated down. Records of unknown migrations are skipped.
+func appliedInRevertOrder(migrations []*Migration, migrationRecords []MigrationRecord, order RevertOrder) []*Migration {
+	byId := make(map[string]*Migration)
+	for _, migration := range migrations {
+		byId[migration.Id] = migration
+	}
+
+	var applied []*Migration
+	appliedAt := make(map[string]time.Time)
+	for _, migrationRecord := range migrationRecords {
+		if migration, ok := byId[migrationRecord.Id]; ok {
+			applied = append(applied, migration)
+			appliedAt[migration.Id] = migrationRecord.AppliedAt
+		}
+	}
+
+	sort.SliceStable(applied, func(i, j int) bool {
+		if order == RevertByAppliedAt {
+			a, b := appliedAt[applied[i].Id], appliedAt[applied[j].Id]
+			if !a.Equal(b) {
+				return a.After(b)
+			}
+		}
+		return applied[j].Less(applied[i])
+	})
+	return applied
+}
+
+// Loads the migrations from the source and the records of the migrations that
+// have been run from the database.
+//
+// Makes sure all migrations in the database are among the found migrations,
+// unless IgnoreUnknown is set.
+func (ms MigrationSet) findMigrationsAndRecords(db *sql.DB, dialect string, m MigrationSource) (*gorp.DbMap, []*Migration, []MigrationRecord, error) {
+	dbMap, err := ms.getMigrationDbMap(db, dialect)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	migrations, err := m.FindMigrations()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	var migrationRecords []MigrationRecord
+	if exists, err := ms.hasMigrationTable(dbMap); err != nil {
+		return nil, nil, nil, err
+	} else if exists {
+		_, err = dbMap.Select(&migrationRecords, fmt.Sprintf("SELECT * FROM %s", dbMap.Dialect.QuotedTableForQuery(ms.SchemaName, ms.getTableName())))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	migrations, migrationRecords, err = resolveSquashedMigrations(migrations, migrationRecords)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if !ms.IgnoreUnknown {
+		migrationsSearch := make(map[string]struct{})
+		for _, migration := range migrations {
+			migrationsSearch[migration.Id] = struct{}{}
+		}
+		for _, migrationRecord := range migrationRecords {
+			if _, ok := migrationsSearch[migrationRecord.Id]; !ok {
+				return nil, nil, nil, newPlanError(&Migration{Id: migrationRecord.Id}, ErrUnknownMigration)
+			}
+		}
+	}
+
+	return dbMap, migrations, migrationRecords, nil
+}
+
+// Treats the migrations that were squashed into another one as that one.
+//
+// Having applied all squashed migrations is the same as having applied the
+// migration they were squashed into, so their records are replaced with a
+// record for it. Squashed migrations that are still among the found migrations
+// are left out, the migration they were squashed into takes their place.
+func resolveSquashedMigrations(migrations []*Migration, migrationRecords []MigrationRecord) ([]*Migration, []MigrationRecord, error) {
+	squashedInto := make(map[string]*Migration)
+	for _, migration := range migrations {
+		for _, id := range migration.Squashes {
+			squashedInto[id] = migration
+		}
+	}
+	if len(squashedInto) == 0 {
+		return migrations, migrationRecords, nil
+	}
+
+	records := make(map[string]MigrationRecord)
+	for _, migrationRecord := range migrationRecords {
+		records[migrationRecord.Id] = migrationRecord
+	}
+
+	resultMigrations := make([]*Migration, 0, len(migrations))
+	resultRecords := make([]MigrationRecord, 0, len(migrationRecords))
+	for _, migration := range migrations {
+		if _, ok := squashedInto[migration.Id]; ok {
+			continue
+		}
+		resultMigrations = append(resultMigrations, migration)
+
+		if len(migration.Squashes) == 0 {
+			continue
+		}
+		if _, ok := records[migration.Id]; ok {
+			continue
+		}
+
+		// The squashed migrations are listed in the order they were applied,
+		// including the ones squashed by an earlier squashed migration, which
+		// might not have been applied when that one was. So the last one tells
+		// whether they all have been.
+		last := migration.Squashes[len(migration.Squashes)-1]
+		if record, ok := records[last]; ok {
+			resultRecords = append(resultRecords, MigrationRecord{
+				Id:        migration.Id,
+				AppliedAt: record.AppliedAt,
 			})
-		case Down:
+			continue
+		}
+		for _, id := range migration.Squashes {
+			if _, ok := records[id]; ok {
+				return nil, nil, newPlanError(migration, errs.Mark(ErrPartiallySquashed, "%s has been applied, but not all migrations it squashes", id))
+			}
+		}
+	}
+
+	for _, migrationRecord := range migrationRecords {
+		if _, ok := squashedInto[migrationRecord.Id]; !ok {
+			resultRecords = append(resultRecords, migrationRecord)
+		}
+	}
+
+	return resultMigrations, resultRecords, nil
+}
+
+// Plan a migration to target.
+func PlanMigrationToTarget(db *sql.DB, dialect string, m MigrationSource, target string) ([]*PlannedMigration, MigrationDirection, *gorp.DbMap, error) {
+	return migSet.PlanMigrationToTarget(db, dialect, m, target)
+}
+
+// Plan a migration to target.
+//
+// The target can be the full Id of a migration, the numeric version of a
+// migration or a point in time. When the target is a migration, all later
+// migrations are migrated down when any of them has been applied, otherwise the
+// target and all earlier migrations are migrated up. When the target is a point
+// in time, all migrations applied after it are migrated down.
+//
+// Returns the planned migrations and the direction in which they run.
+func (ms MigrationSet) PlanMigrationToTarget(db *sql.DB, dialect string, m MigrationSource, target string) ([]*PlannedMigration, MigrationDirection, *gorp.DbMap, error) {
+	dbMap, migrations, migrationRecords, err := ms.findMigrationsAndRecords(db, dialect, m)
+	if err != nil {
+		return nil, Up, nil, err
+	}
+
+	applied := make(map[string]MigrationRecord)
+	for _, migrationRecord := range migrationRecords {
+		applied[migrationRecord.Id] = migrationRecord
+	}
+
+	targetMigration, err := findTargetMigration(migrations, target)
+	if err != nil {
+		return nil, Up, nil, err
+	}
+
+	result := make([]*PlannedMigration, 0)
+
+	if targetMigration == nil {
+		appliedBefore, ok := parseTargetTime(target)
+		if !ok {
+			return nil, Up, nil, newPlanError(&Migration{Id: target}, ErrTargetNotFound)
+		}
+
+		for _, migration := range appliedInRevertOrder(migrations, migrationRecords, ms.RevertOrder) {
+			if applied[migration.Id].AppliedAt.After(appliedBefore) {
+				planned, err := ms.planDown(migration)
+				if err != nil {
+					return nil, Down, nil, err
+				}
+				result = append(result, planned)
+			}
+		}
+		return result, Down, dbMap, nil
+	}
+
+	for _, migration := range appliedInRevertOrder(migrations, migrationRecords, ms.RevertOrder) {
+		if targetMigration.Less(migration) {
+			planned, err := ms.planDown(migration)
+			if err != nil {
+				return nil, Down, nil, err
+			}
+			result = append(result, planned)
+		}
+	}
+	if len(result) > 0 {
+		return result, Down, dbMap, nil
+	}
+
+	for _, migration := range migrations {
+		if _, ok := applied[migration.Id]; !ok && !targetMigration.Less(migration) {
 			result = append(result, &PlannedMigration{
-				Migration:          v,
-				Queries:            v.Down,
-				DisableTransaction: v.DisableTransactionDown,
+				Migration:          migration,
+				Queries:            migration.Up,
+				DisableTransaction: migration.DisableTransactionUp,
 			})
 		}
 	}
+	return result, Up, dbMap, nil
+}
 
-	return result, dbMap, nil
+// Finds the migration that has the target as its Id or its version. Returns
+// nil if the target isn't a number and doesn't match any Id.
+func findTargetMigration(migrations []*Migration, target string) (*Migration, error) {
+	for _, migration := range migrations {
+		if migration.Id == target {
+			return migration, nil
+		}
+	}
+
+	version, err := strconv.ParseInt(target, 10, 64)
+	if err != nil {
+		// Not a version either, the target might be a point in time.
+		return nil, nil
+	}
+
+	var found *Migration
+	for _, migration := range migrations {
+		if v, err := migration.Version(); err == nil && v == version {
+			if found != nil {
+				return nil, newPlanError(&Migration{Id: target}, errs.Mark(ErrAmbiguousVersion, "version is ambiguous, both %s and %s have it", found.Id, migration.Id))
+			}
+			found = migration
+		}
+	}
+	if found == nil {
+		return nil, newPlanError(&Migration{Id: target}, errs.Mark(ErrVersionNotFound, "unknown migration with version id %d", version))
+	}
+	return found, nil
+}
+
+var targetTimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// Parses a point in time, times without a zone are taken to be local.
+func parseTargetTime(target string) (time.Time, bool) {
+	for _, layout := range targetTimeLayouts {
+		if t, err := time.ParseInLocation(layout, target, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
 }
 
 // Skip a set of migrations
@@ -730,6 +1836,11 @@ func SkipMax(db *sql.DB, dialect string, m MigrationSource, dir MigrationDirecti
 		return 0, err
 	}
 
+	if err := migSet.createTables(dbMap); err != nil {
+		return 0, err
+	}
+	checksums := migSet.hasChecksumTable(dbMap)
+
 	// Skip migrations
 	applied := 0
 	for _, migration := range migrations {
@@ -748,6 +1859,9 @@ func SkipMax(db *sql.DB, dialect string, m MigrationSource, dir MigrationDirecti
 			Id:        migration.Id,
 			AppliedAt: time.Now(),
 		})
+		if err == nil && checksums {
+			err = recordChecksum(executor, migration.Migration)
+		}
 		if err != nil {
 			if trans, ok := executor.(*gorp.Transaction); ok {
 				_ = trans.Rollback()
@@ -829,6 +1943,10 @@ func (ms MigrationSet) GetMigrationRecords(db *sql.DB, dialect string) ([]*Migra
 	}
 
 	var records []*MigrationRecord
+	if exists, err := ms.hasMigrationTable(dbMap); err != nil || !exists {
+		return records, err
+	}
+
 	query := fmt.Sprintf("SELECT * FROM %s ORDER BY %s ASC", dbMap.Dialect.QuotedTableForQuery(ms.SchemaName, ms.getTableName()), dbMap.Dialect.QuoteField("id"))
 	_, err = dbMap.Select(&records, query)
 	if err != nil {
@@ -838,6 +1956,64 @@ func (ms MigrationSet) GetMigrationRecords(db *sql.DB, dialect string) ([]*Migra
 	return records, nil
 }
 
+// Renames the records of applied migrations, for example after the migration
+// files have been renumbered. Maps the old Ids to the new ones.
+//
+// All records are renamed in a single transaction. Every old Id must have been
+// applied and none of the new Ids may have been, otherwise nothing is renamed.
+func RenameMigrationRecords(db *sql.DB, dialect string, renames map[string]string) error {
+	return migSet.RenameMigrationRecords(db, dialect, renames)
+}
+
+func (ms MigrationSet) RenameMigrationRecords(db *sql.DB, dialect string, renames map[string]string) error {
+	records, err := ms.GetMigrationRecords(db, dialect)
+	if err != nil {
+		return err
+	}
+
+	applied := make(map[string]bool)
+	for _, record := range records {
+		applied[record.Id] = true
+	}
+	for from, to := range renames {
+		if !applied[from] {
+			return fmt.Errorf("Cannot rename migration record %s: it has not been applied", from)
+		}
+		if applied[to] {
+			return fmt.Errorf("Cannot rename migration record %s: %s has already been applied", from, to)
+		}
+	}
+
+	dbMap, err := ms.getMigrationDbMap(db, dialect)
+	if err != nil {
+		return err
+	}
+
+	trans, err := dbMap.Begin()
+	if err != nil {
+		return err
+	}
+
+	tables := []string{ms.getTableName()}
+	if ms.hasChecksumTable(dbMap) {
+		tables = append(tables, ms.getChecksumTableName())
+	}
+	for _, table := range tables {
+		query := fmt.Sprintf("UPDATE %s SET %s = %s WHERE %s = %s",
+			dbMap.Dialect.QuotedTableForQuery(ms.SchemaName, table),
+			dbMap.Dialect.QuoteField("id"), dbMap.Dialect.BindVar(0),
+			dbMap.Dialect.QuoteField("id"), dbMap.Dialect.BindVar(1))
+		for from, to := range renames {
+			if _, err := trans.Exec(query, to, from); err != nil {
+				_ = trans.Rollback()
+				return fmt.Errorf("Cannot rename migration record %s: %w", from, err)
+			}
+		}
+	}
+
+	return trans.Commit()
+}
+
 func (ms MigrationSet) getMigrationDbMap(db *sql.DB, dialect string) (*gorp.DbMap, error) {
 	d, ok := MigrationDialects[dialect]
 	if !ok {
@@ -866,26 +2042,123 @@ Check https://github.com/go-sql-driver/mysql#parsetime for more info.`)
 	// Create migration database map
 	dbMap := &gorp.DbMap{Db: db, Dialect: d}
 	table := dbMap.AddTableWithNameAndSchema(MigrationRecord{}, ms.SchemaName, ms.getTableName()).SetKeys(false, "Id")
+	checksumTable := dbMap.AddTableWithNameAndSchema(checksumRecord{}, ms.SchemaName, ms.getChecksumTableName()).SetKeys(false, "Id")
 
 	if dialect == "oci8" || dialect == "godror" {
 		table.ColMap("Id").SetMaxSize(4000)
+		checksumTable.ColMap("Id").SetMaxSize(4000)
 	}
 
+	return dbMap, nil
+}
+
+// Creates the migration tables of a database map from getMigrationDbMap,
+// unless DisableCreateTable is set. Only operations that write to them do so,
+// reading treats missing tables as empty.
+func (ms MigrationSet) createTables(dbMap *gorp.DbMap) error {
 	if ms.DisableCreateTable {
-		return dbMap, nil
+		return nil
 	}
 
-	err := dbMap.CreateTablesIfNotExists()
-	if err != nil {
-		// Oracle database does not support `if not exists`, so use `ORA-00955:` error code
-		// to check if the table exists.
-		if (dialect == "oci8" || dialect == "godror") && strings.Contains(err.Error(), "ORA-00955:") {
-			return dbMap, nil
+	// The tables are created one by one, so an existing migration table
+	// doesn't keep the checksum table from being created.
+	for _, record := range []interface{}{MigrationRecord{}, checksumRecord{}} {
+		table, err := dbMap.TableFor(reflect.TypeOf(record), false)
+		if err != nil {
+			return err
+		}
+
+		_, err = dbMap.Exec(table.SqlForCreate(true))
+		if err != nil {
+			// Oracle database does not support `if not exists`, so use `ORA-00955:` error code
+			// to check if the table exists.
+			if _, ok := dbMap.Dialect.(OracleDialect); ok && strings.Contains(err.Error(), "ORA-00955:") {
+				continue
+			}
+			return err
 		}
-		return nil, err
 	}
 
-	return dbMap, nil
+	return nil
+}
+
+// Whether the migration table exists.
+func (ms MigrationSet) hasMigrationTable(dbMap *gorp.DbMap) (bool, error) {
+	return tableExists(dbMap, ms.SchemaName, ms.getTableName())
+}
+
+// Whether the checksum table can be used. It is created along with the
+// migration table, but is missing when the tables were created by an older
+// version, or aren't created by sql-migrate (see DisableCreateTable).
+func (ms MigrationSet) hasChecksumTable(dbMap *gorp.DbMap) bool {
+	exists, err := tableExists(dbMap, ms.SchemaName, ms.getChecksumTableName())
+	return err == nil && exists
+}
+
+// Looks up a table in the catalog of the database, without touching the
+// table itself. An empty schema is the current one.
+func tableExists(dbMap *gorp.DbMap, schema, table string) (bool, error) {
+	bind0, bind1 := dbMap.Dialect.BindVar(0), dbMap.Dialect.BindVar(1)
+	args := []interface{}{schema, table}
+
+	var query string
+	switch dbMap.Dialect.(type) {
+	case gorp.SqliteDialect:
+		// SQLite doesn't have schemas, the dialect leaves them out as well.
+		query = "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = " + bind0
+		args = []interface{}{table}
+	case gorp.PostgresDialect:
+		// The schema isn't quoted, so it's folded to lower case.
+		query = fmt.Sprintf("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = COALESCE(NULLIF(LOWER(%s), ''), current_schema()) AND table_name = %s", bind0, bind1)
+	case gorp.MySQLDialect:
+		query = fmt.Sprintf("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = COALESCE(NULLIF(%s, ''), DATABASE()) AND table_name = %s", bind0, bind1)
+	case gorp.SqlServerDialect:
+		query = fmt.Sprintf("SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA = COALESCE(NULLIF(%s, ''), SCHEMA_NAME()) AND TABLE_NAME = %s", bind0, bind1)
+	case gorp.SnowflakeDialect:
+		query = fmt.Sprintf("SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = COALESCE(NULLIF(UPPER(%s), ''), CURRENT_SCHEMA()) AND table_name = %s", bind0, bind1)
+	case OracleDialect:
+		// Oracle treats '' as NULL. The dialect quotes table names in upper case.
+		query = fmt.Sprintf("SELECT COUNT(*) FROM all_tables WHERE owner = NVL(UPPER(%s), SYS_CONTEXT('USERENV', 'CURRENT_SCHEMA')) AND table_name = %s", bind0, bind1)
+		args = []interface{}{schema, strings.ToUpper(table)}
+	default:
+		// Reading the table fails when it doesn't exist.
+		return true, nil
+	}
+
+	n, err := dbMap.SelectInt(query, args...)
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// Stores the checksum of a migration that was applied, replacing a stale one.
+func recordChecksum(executor SqlExecutor, migration *Migration) error {
+	if _, err := executor.Delete(&checksumRecord{Id: migration.Id}); err != nil {
+		return err
+	}
+	return executor.Insert(&checksumRecord{
+		Id:       migration.Id,
+		Checksum: migration.Checksum(),
+	})
+}
+
+// Returns the checksums of the applied migrations, by id.
+func (ms MigrationSet) getChecksums(dbMap *gorp.DbMap) (map[string]string, error) {
+	checksums := make(map[string]string)
+	if !ms.hasChecksumTable(dbMap) {
+		return checksums, nil
+	}
+
+	var records []checksumRecord
+	_, err := dbMap.Select(&records, fmt.Sprintf("SELECT * FROM %s", dbMap.Dialect.QuotedTableForQuery(ms.SchemaName, ms.getChecksumTableName())))
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		checksums[record.Id] = record.Checksum
+	}
+	return checksums, nil
 }
 
 // TODO: Run migration + record insert in transaction.
@@ -4,13 +4,21 @@ import (
 	"context"
 	"database/sql"
 	"embed"
+	"errors"
 	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing/fstest"
 	"time"
 
 	"github.com/go-gorp/gorp/v3"
 	//revive:disable-next-line:dot-imports
 	. "gopkg.in/check.v1"
 
+	"github.com/rubenv/sql-migrate/sqlparse"
+
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -146,6 +154,206 @@ func (s *SqliteMigrateSuite) TestHttpFileSystemMigrate(c *C) {
 	c.Assert(id, Equals, int64(1))
 }
 
+func (*SqliteMigrateSuite) writeMigrationTree(c *C) string {
+	dir := c.MkDir()
+	files := map[string]string{
+		"1_initial.sql":             "-- +migrate Up\nCREATE TABLE people (id int);\n",
+		"2024/2_record.sql":         "-- +migrate Up\nINSERT INTO people (id) VALUES (1);\n",
+		"2024/01/10_more.sql":       "-- +migrate Up\nINSERT INTO people (id) VALUES (2);\n",
+		"_archive/0_old.sql":        "-- +migrate Up\nSELECT 0;\n",
+		".hidden/0_hidden.sql":      "-- +migrate Up\nSELECT 0;\n",
+		"2024/01/notes-for-team.md": "Not a migration",
+	}
+	for name, content := range files {
+		c.Assert(os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755), IsNil)
+		c.Assert(os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600), IsNil)
+	}
+	return dir
+}
+
+func (s *SqliteMigrateSuite) TestFileMigrateRecursive(c *C) {
+	dir := s.writeMigrationTree(c)
+
+	migrations, err := FileMigrationSource{Dir: dir}.FindMigrations()
+	c.Assert(err, IsNil)
+	c.Assert(migrations, HasLen, 1)
+
+	migrations, err = FileMigrationSource{Dir: dir, Recursive: true}.FindMigrations()
+	c.Assert(err, IsNil)
+	c.Assert(migrations, HasLen, 3)
+	c.Assert(migrations[0].Id, Equals, "1_initial.sql")
+	c.Assert(migrations[1].Id, Equals, "2_record.sql")
+	c.Assert(migrations[2].Id, Equals, "10_more.sql")
+
+	// Still ordered by the number of the file name
+	source := FileMigrationSource{Dir: dir, Recursive: true, IdScheme: IdRelativePath}
+	migrations, err = source.FindMigrations()
+	c.Assert(err, IsNil)
+	c.Assert(migrations, HasLen, 3)
+	c.Assert(migrations[0].Id, Equals, "1_initial.sql")
+	c.Assert(migrations[1].Id, Equals, "2024/2_record.sql")
+	c.Assert(migrations[2].Id, Equals, "2024/01/10_more.sql")
+	c.Assert(migrations[2].VersionInt(), Equals, int64(10))
+
+	paths, err := FileMigrationSource{Dir: dir, Recursive: true}.FindMigrationFiles()
+	c.Assert(err, IsNil)
+	c.Assert(paths, DeepEquals, map[string]string{
+		"1_initial.sql": "1_initial.sql",
+		"2_record.sql":  "2024/2_record.sql",
+		"10_more.sql":   "2024/01/10_more.sql",
+	})
+
+	n, err := Exec(s.Db, "sqlite3", source, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 3)
+}
+
+func (s *SqliteMigrateSuite) TestFileMigrateRecursiveCollision(c *C) {
+	dir := s.writeMigrationTree(c)
+	c.Assert(os.WriteFile(filepath.Join(dir, "2024", "1_initial.sql"), []byte("-- +migrate Up\nSELECT 1;\n"), 0o600), IsNil)
+
+	_, err := FileMigrationSource{Dir: dir, Recursive: true}.FindMigrations()
+	c.Assert(err, ErrorMatches, "Duplicate migration id 1_initial.sql: 1_initial.sql and 2024/1_initial.sql")
+
+	_, err = FileMigrationSource{Dir: dir, Recursive: true, IdScheme: IdRelativePath}.FindMigrations()
+	c.Assert(err, IsNil)
+}
+
+func (s *SqliteMigrateSuite) TestFSMigrate(c *C) {
+	migrations := FSMigrationSource{
+		FileSystem: os.DirFS("test-migrations"),
+	}
+
+	// Executes two migrations
+	n, err := Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	// Has data
+	id, err := s.DbMap.SelectInt("SELECT id FROM people")
+	c.Assert(err, IsNil)
+	c.Assert(id, Equals, int64(1))
+}
+
+func (*SqliteMigrateSuite) TestFSMigrateFilters(c *C) {
+	up := &fstest.MapFile{Data: []byte("-- +migrate Up\nSELECT 1;\n")}
+	fsys := fstest.MapFS{
+		"db/1_initial.sql":        up,
+		"db/2_seed.sql":           up,
+		"db/3_more.sql":           up,
+		"db/local/4_fixtures.sql": up,
+		"db/local/5_other.sql":    up,
+		"other/6_elsewhere.sql":   up,
+	}
+
+	ids := func(source FSMigrationSource) []string {
+		migrations, err := source.FindMigrations()
+		c.Assert(err, IsNil)
+		var ids []string
+		for _, m := range migrations {
+			ids = append(ids, m.Id)
+		}
+		return ids
+	}
+
+	c.Assert(ids(FSMigrationSource{FileSystem: fsys, Root: "db"}), DeepEquals,
+		[]string{"1_initial.sql", "2_seed.sql", "3_more.sql"})
+	c.Assert(ids(FSMigrationSource{FileSystem: fsys, Root: "db", Exclude: []string{"*_seed.sql"}}), DeepEquals,
+		[]string{"1_initial.sql", "3_more.sql"})
+	c.Assert(ids(FSMigrationSource{FileSystem: fsys, Root: "db", Recursive: true, IdScheme: IdRelativePath, Include: []string{"local/*"}}), DeepEquals,
+		[]string{"local/4_fixtures.sql", "local/5_other.sql"})
+	c.Assert(ids(FSMigrationSource{FileSystem: fsys, Root: "db", Recursive: true, Include: []string{"[15]_*"}, Exclude: []string{"local/5_*"}}), DeepEquals,
+		[]string{"1_initial.sql"})
+
+	_, err := FSMigrationSource{FileSystem: fsys, Include: []string{"["}}.FindMigrations()
+	c.Assert(err, ErrorMatches, `Invalid pattern "\[": syntax error in pattern`)
+}
+
+func (*SqliteMigrateSuite) TestFSMigrateParseOptions(c *C) {
+	fsys := fstest.MapFS{
+		"1_initial.sql": &fstest.MapFile{Data: []byte("-- +migrate Up\nSELECT 1\nGO\nSELECT 2\nGO\n")},
+	}
+
+	migrations, err := FSMigrationSource{
+		FileSystem:   fsys,
+		ParseOptions: &sqlparse.ParseOptions{Separator: "GO"},
+	}.FindMigrations()
+	c.Assert(err, IsNil)
+	c.Assert(migrations, HasLen, 1)
+	c.Assert(migrations[0].Up, DeepEquals, []string{"SELECT 1\n", "SELECT 2\n"})
+
+	_, err = FSMigrationSource{FileSystem: fsys}.FindMigrations()
+	c.Assert(err, NotNil)
+}
+
+// statementLog records the statements traced by gorp.
+type statementLog []string
+
+func (l *statementLog) Printf(_ string, v ...interface{}) {
+	*l = append(*l, v[1].(string))
+}
+
+func (s *SqliteMigrateSuite) TestPLSQLBlockKeepsSemicolon(c *C) {
+	fsys := fstest.MapFS{
+		"1_initial.sql": &fstest.MapFile{Data: []byte(`-- +migrate Up
+CREATE TABLE people (id int);
+CREATE TRIGGER people_insert AFTER INSERT ON people
+BEGIN
+    UPDATE people SET id = id;
+END;
+/
+-- +migrate Down
+DROP TABLE people;
+`)},
+	}
+	migrations := FSMigrationSource{
+		FileSystem:   fsys,
+		ParseOptions: &sqlparse.ParseOptions{Separator: "/"},
+	}
+
+	plan, dbMap, err := PlanMigration(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, IsNil)
+
+	c.Assert(migSet.createTables(dbMap), IsNil)
+	var log statementLog
+	dbMap.TraceOn("", &log)
+	c.Assert(migSet.applyMigration(context.Background(), Up, plan[0], dbMap), IsNil)
+
+	i := slices.Index(log, "CREATE TABLE people (id int)")
+	c.Assert(i, Not(Equals), -1)
+	c.Assert([]string(log[i:i+2]), DeepEquals, []string{
+		"CREATE TABLE people (id int)",
+		"CREATE TRIGGER people_insert AFTER INSERT ON people\nBEGIN\n    UPDATE people SET id = id;\nEND;",
+	})
+}
+
+func (*SqliteMigrateSuite) TestHttpFileSystemMigrateRecursive(c *C) {
+	up := &fstest.MapFile{Data: []byte("-- +migrate Up\nSELECT 1;\n")}
+	migrations, err := HttpFileSystemMigrationSource{
+		FileSystem: http.FS(fstest.MapFS{
+			"1_initial.sql":    up,
+			"2024/2_later.sql": up,
+		}),
+		Recursive: true,
+		IdScheme:  IdRelativePath,
+	}.FindMigrations()
+	c.Assert(err, IsNil)
+	c.Assert(migrations, HasLen, 2)
+	c.Assert(migrations[1].Id, Equals, "2024/2_later.sql")
+}
+
+func (*SqliteMigrateSuite) TestHttpFileSystemMigrateDotFile(c *C) {
+	migrations, err := HttpFileSystemMigrationSource{
+		FileSystem: http.FS(fstest.MapFS{
+			".1_initial.sql": &fstest.MapFile{Data: []byte("-- +migrate Up\nSELECT 1;\n")},
+		}),
+	}.FindMigrations()
+	c.Assert(err, IsNil)
+	c.Assert(migrations, HasLen, 1)
+	c.Assert(migrations[0].Id, Equals, ".1_initial.sql")
+	c.Assert(migrations[0].Up, DeepEquals, []string{"SELECT 1;\n"})
+}
+
 func (s *SqliteMigrateSuite) TestAssetMigrate(c *C) {
 	migrations := &AssetMigrationSource{
 		Asset:    Asset,
@@ -321,6 +529,118 @@ func (s *SqliteMigrateSuite) TestMigrateTransaction(c *C) {
 	c.Assert(count, Equals, int64(0))
 }
 
+func (*SqliteMigrateSuite) TestFSMigrateInclude(c *C) {
+	fsys := fstest.MapFS{
+		"db/1_initial.sql":          &fstest.MapFile{Data: []byte("-- +migrate Up\n-- +migrate Include _fragments/tables.sql\n")},
+		"db/_fragments/tables.sql":  &fstest.MapFile{Data: []byte("CREATE TABLE people (id int);\n")},
+		"db/2_escape.sql":           &fstest.MapFile{Data: []byte("-- +migrate Up\n-- +migrate Include ../secret.sql\n")},
+		"secret.sql":                &fstest.MapFile{Data: []byte("SELECT 1;\n")},
+		"db/_fragments/unused.sql":  &fstest.MapFile{Data: []byte("SELECT 2;\n")},
+		"db/_fragments/3_notme.sql": &fstest.MapFile{Data: []byte("SELECT 3;\n")},
+	}
+	source := FSMigrationSource{FileSystem: fsys, Root: "db", Recursive: true, Exclude: []string{"2_escape.sql"}}
+
+	migrations, err := source.FindMigrations()
+	c.Assert(err, IsNil)
+	c.Assert(migrations, HasLen, 1)
+	c.Assert(migrations[0].Up, DeepEquals, []string{"CREATE TABLE people (id int);\n"})
+	checksum := migrations[0].Checksum()
+
+	// Changing a fragment changes the checksum of the migrations including it.
+	fsys["db/_fragments/tables.sql"] = &fstest.MapFile{Data: []byte("CREATE TABLE people (id bigint);\n")}
+	migrations, err = source.FindMigrations()
+	c.Assert(err, IsNil)
+	c.Assert(migrations[0].Checksum(), Not(Equals), checksum)
+
+	source.Exclude = nil
+	_, err = source.FindMigrations()
+	c.Assert(err, ErrorMatches, "Error while parsing 2_escape.sql: .*Invalid include path: ../secret.sql")
+}
+
+func (s *SqliteMigrateSuite) TestFSMigrateStream(c *C) {
+	fsys := fstest.MapFS{
+		"1_initial.sql": &fstest.MapFile{Data: []byte(`-- +migrate Up
+CREATE TABLE people (id int);
+INSERT INTO people VALUES (1), (2), (3);
+
+-- +migrate Down
+DROP TABLE people;
+`)},
+		"2_fail.sql": &fstest.MapFile{Data: []byte("-- +migrate Up\nSELECT 1;\nSELECT fail;\n")},
+	}
+	source := FSMigrationSource{FileSystem: fsys, StreamLargerThan: 1, Exclude: []string{"2_fail.sql"}}
+
+	migrations, err := source.FindMigrations()
+	c.Assert(err, IsNil)
+	c.Assert(migrations[0].Up, HasLen, 0)
+	c.Assert(migrations[0].Stream, NotNil)
+
+	// The checksum doesn't depend on streaming.
+	inMemory, err := FSMigrationSource{FileSystem: fsys, Exclude: []string{"2_fail.sql"}}.FindMigrations()
+	c.Assert(err, IsNil)
+	c.Assert(migrations[0].Checksum(), Equals, inMemory[0].Checksum())
+
+	n, err := Exec(s.Db, "sqlite3", source, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	count, err := s.DbMap.SelectInt("SELECT COUNT(*) FROM people")
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, int64(3))
+
+	source.Exclude = nil
+	_, err = Exec(s.Db, "sqlite3", source, Up)
+	var txErr *TxError
+	c.Assert(errors.As(err, &txErr), Equals, true)
+	c.Assert(txErr.Migration.Id, Equals, "2_fail.sql")
+	c.Assert(txErr.StatementIndex, Equals, 1)
+	c.Assert(txErr.Position, Equals, sqlparse.StatementPosition{StartLine: 3, EndLine: 3})
+
+	n, err = ExecMax(s.Db, "sqlite3", source, Down, 1)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	// A migration that stopped parsing after it was found fails while it's
+	// executed.
+	migrations, err = source.FindMigrations()
+	c.Assert(err, IsNil)
+	initial := fsys["1_initial.sql"]
+	fsys["1_initial.sql"] = &fstest.MapFile{Data: []byte("-- +migrate Up\nSELECT 'unterminated;\n")}
+	for _, stmtErr := range migrations[0].Statements(Up) {
+		err = stmtErr
+	}
+	var parseErr *ParseError
+	c.Assert(errors.As(err, &parseErr), Equals, true)
+	c.Assert(err, ErrorMatches, `Error parsing migration \(1_initial.sql\): ERROR: unterminated string literal`)
+	fsys["1_initial.sql"] = initial
+
+	// A migration that doesn't parse is reported when it's found.
+	fsys["3_broken.sql"] = &fstest.MapFile{Data: []byte("-- +migrate Up\nSELECT 'unterminated;\n")}
+	_, err = source.FindMigrations()
+	c.Assert(err, ErrorMatches, `Error while parsing 3_broken.sql: Error parsing migration \(3_broken.sql\): ERROR: unterminated string literal`)
+}
+
+func (s *SqliteMigrateSuite) TestStatementError(c *C) {
+	migration, err := ParseMigration("1_fail.sql", strings.NewReader(`-- +migrate Up
+CREATE TABLE people (id int);
+
+-- Fails
+INSERT INTO people
+  VALUES (1, 'too many values');
+`))
+	c.Assert(err, IsNil)
+
+	_, err = Exec(s.Db, "sqlite3", &MemoryMigrationSource{Migrations: []*Migration{migration}}, Up)
+	var txErr *TxError
+	c.Assert(errors.As(err, &txErr), Equals, true)
+	c.Assert(txErr.StatementIndex, Equals, 1)
+	c.Assert(txErr.Position, Equals, sqlparse.StatementPosition{StartLine: 5, EndLine: 6})
+	c.Assert(txErr.Statement, Equals, "INSERT INTO people\n  VALUES (1, 'too many values');")
+	c.Assert(err, ErrorMatches, ".* handling 1_fail.sql \\(statement 2, line 5\\)")
+
+	c.Assert(truncateStatement("SELECT 'é'", 9), Equals, "SELECT '...")
+}
+
 func (s *SqliteMigrateSuite) TestPlanMigration(c *C) {
 	migrations := &MemoryMigrationSource{
 		Migrations: []*Migration{
@@ -452,25 +772,124 @@ func (s *SqliteMigrateSuite) TestPlanMigrationWithHoles(c *C) {
 	c.Assert(plannedMigrations[2].Id, Equals, "5")
 	c.Assert(plannedMigrations[2].Queries[0], Equals, up)
 
-	// first catch up to current target state 123, then migrate down 1 step to 12
+	// only the applied migrations 1 and 3 are migrated down, the holes are left alone
 	plannedMigrations, _, err = PlanMigration(s.Db, "sqlite3", migrations, Down, 1)
 	c.Assert(err, IsNil)
+	c.Assert(plannedMigrations, HasLen, 1)
+	c.Assert(plannedMigrations[0].Id, Equals, "3")
+	c.Assert(plannedMigrations[0].Queries[0], Equals, down)
+
+	plannedMigrations, _, err = PlanMigration(s.Db, "sqlite3", migrations, Down, 0)
+	c.Assert(err, IsNil)
 	c.Assert(plannedMigrations, HasLen, 2)
-	c.Assert(plannedMigrations[0].Id, Equals, "2")
-	c.Assert(plannedMigrations[0].Queries[0], Equals, up)
-	c.Assert(plannedMigrations[1].Id, Equals, "3")
+	c.Assert(plannedMigrations[0].Id, Equals, "3")
+	c.Assert(plannedMigrations[0].Queries[0], Equals, down)
+	c.Assert(plannedMigrations[1].Id, Equals, "1")
 	c.Assert(plannedMigrations[1].Queries[0], Equals, down)
 
-	// first catch up to current target state 123, then migrate down 2 steps to 1
-	plannedMigrations, _, err = PlanMigration(s.Db, "sqlite3", migrations, Down, 2)
+	n, err = Exec(s.Db, "sqlite3", migrations, Down)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+}
+
+func (s *SqliteMigrateSuite) TestPlanMigrationRevertByAppliedAt(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			{Id: "1", Up: []string{"SELECT 0"}, Down: []string{"SELECT 1"}},
+			{Id: "3", Up: []string{"SELECT 0"}, Down: []string{"SELECT 1"}},
+		},
+	}
+	_, err := Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+
+	// 2 is applied after 3, as happens after merging a branch.
+	migrations.Migrations = append(migrations.Migrations, &Migration{Id: "2", Up: []string{"SELECT 0"}, Down: []string{"SELECT 1"}})
+	_, err = s.DbMap.Exec("UPDATE gorp_migrations SET applied_at = ?", time.Now().Add(-time.Hour))
+	c.Assert(err, IsNil)
+	_, err = Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+
+	plannedMigrations, _, err := PlanMigration(s.Db, "sqlite3", migrations, Down, 0)
+	c.Assert(err, IsNil)
+	c.Assert(plannedMigrations, HasLen, 3)
+	c.Assert(plannedMigrations[0].Id, Equals, "3")
+	c.Assert(plannedMigrations[1].Id, Equals, "2")
+	c.Assert(plannedMigrations[2].Id, Equals, "1")
+
+	ms := MigrationSet{RevertOrder: RevertByAppliedAt}
+	plannedMigrations, _, err = ms.PlanMigration(s.Db, "sqlite3", migrations, Down, 0)
 	c.Assert(err, IsNil)
 	c.Assert(plannedMigrations, HasLen, 3)
 	c.Assert(plannedMigrations[0].Id, Equals, "2")
-	c.Assert(plannedMigrations[0].Queries[0], Equals, up)
 	c.Assert(plannedMigrations[1].Id, Equals, "3")
-	c.Assert(plannedMigrations[1].Queries[0], Equals, down)
-	c.Assert(plannedMigrations[2].Id, Equals, "2")
-	c.Assert(plannedMigrations[2].Queries[0], Equals, down)
+	c.Assert(plannedMigrations[2].Id, Equals, "1")
+
+	// 2 was applied after 3, so it's reverted first.
+	plannedMigrations, _, err = ms.PlanMigrationToVersion(s.Db, "sqlite3", migrations, Down, 3)
+	c.Assert(err, IsNil)
+	c.Assert(plannedMigrations, HasLen, 2)
+	c.Assert(plannedMigrations[0].Id, Equals, "2")
+	c.Assert(plannedMigrations[1].Id, Equals, "3")
+
+	plannedMigrations, _, err = ms.PlanMigrationToVersion(s.Db, "sqlite3", migrations, Down, 2)
+	c.Assert(err, IsNil)
+	c.Assert(plannedMigrations, HasLen, 1)
+	c.Assert(plannedMigrations[0].Id, Equals, "2")
+}
+
+func (s *SqliteMigrateSuite) TestPlanMigrationIrreversible(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			{Id: "1", Up: []string{"SELECT 0"}, Down: []string{"SELECT 1"}},
+			{Id: "2", Up: []string{"SELECT 0"}, Irreversible: true},
+			{Id: "3", Up: []string{"SELECT 0"}, Down: []string{"SELECT 1"}},
+		},
+	}
+	_, err := Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+
+	plannedMigrations, _, err := PlanMigration(s.Db, "sqlite3", migrations, Down, 1)
+	c.Assert(err, IsNil)
+	c.Assert(plannedMigrations, HasLen, 1)
+
+	_, _, err = PlanMigration(s.Db, "sqlite3", migrations, Down, 2)
+	c.Assert(errors.Is(err, ErrIrreversible), Equals, true)
+	c.Assert(err, ErrorMatches, "Unable to create migration plan because of 2: migration is irreversible")
+
+	_, _, _, err = PlanMigrationToTarget(s.Db, "sqlite3", migrations, "1")
+	c.Assert(errors.Is(err, ErrIrreversible), Equals, true)
+
+	// Nothing was migrated down.
+	records, err := GetMigrationRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 3)
+}
+
+func (s *SqliteMigrateSuite) TestPlanMigrationEmptyDown(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			{Id: "1", Up: []string{"SELECT 0"}},
+		},
+	}
+	_, err := Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+
+	plannedMigrations, _, err := PlanMigration(s.Db, "sqlite3", migrations, Down, 0)
+	c.Assert(err, IsNil)
+	c.Assert(plannedMigrations, HasLen, 1)
+
+	var warnings []error
+	ms := MigrationSet{EmptyDown: EmptyDownWarn, Warn: func(err error) { warnings = append(warnings, err) }}
+	plannedMigrations, _, err = ms.PlanMigration(s.Db, "sqlite3", migrations, Down, 0)
+	c.Assert(err, IsNil)
+	c.Assert(plannedMigrations, HasLen, 1)
+	c.Assert(warnings, HasLen, 1)
+	c.Assert(errors.Is(warnings[0], ErrEmptyDown), Equals, true)
+	c.Assert(warnings[0], ErrorMatches, "1: migration has no Down statements")
+
+	ms = MigrationSet{EmptyDown: EmptyDownError}
+	_, err = ms.Exec(s.Db, "sqlite3", migrations, Down)
+	c.Assert(errors.Is(err, ErrEmptyDown), Equals, true)
 }
 
 func (*SqliteMigrateSuite) TestLess(c *C) {
@@ -743,6 +1162,7 @@ func (s *SqliteMigrateSuite) TestGetMigrationObjDbMapWithDisableCreateTableTrue(
 	dbMap, err := ms.getMigrationDbMap(s.Db, "sqlite3")
 	c.Assert(err, IsNil)
 	c.Assert(dbMap, NotNil)
+	c.Assert(ms.createTables(dbMap), IsNil)
 
 	tableNameIfExists, err := s.DbMap.SelectNullStr(
 		"SELECT name FROM sqlite_master WHERE type='table' AND name=$1",
@@ -767,6 +1187,7 @@ func (s *SqliteMigrateSuite) TestGetMigrationObjDbMapWithDisableCreateTableFalse
 	dbMap, err := ms.getMigrationDbMap(s.Db, "sqlite3")
 	c.Assert(err, IsNil)
 	c.Assert(dbMap, NotNil)
+	c.Assert(ms.createTables(dbMap), IsNil)
 
 	tableNameIfExists, err := s.DbMap.SelectNullStr(
 		"SELECT name FROM sqlite_master WHERE type='table' AND name=$1",
@@ -777,6 +1198,35 @@ func (s *SqliteMigrateSuite) TestGetMigrationObjDbMapWithDisableCreateTableFalse
 	c.Assert(tableNameIfExists.String, Equals, ms.TableName)
 }
 
+func (s *SqliteMigrateSuite) TestReadOnlyWithoutTable(c *C) {
+	migrations := &MemoryMigrationSource{Migrations: sqliteMigrations[:1]}
+
+	planned, _, err := PlanMigration(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, IsNil)
+	c.Assert(planned, HasLen, 1)
+
+	records, err := GetMigrationRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 0)
+
+	report, err := Status(context.Background(), s.Db, "sqlite3", migrations)
+	c.Assert(err, IsNil)
+	c.Assert(report.Pending(), HasLen, 1)
+
+	count, err := s.DbMap.SelectInt("SELECT COUNT(*) FROM sqlite_master WHERE type='table'")
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, int64(0))
+
+	// Tables are created when migrating, even when there's nothing to apply.
+	n, err := Exec(s.Db, "sqlite3", &MemoryMigrationSource{}, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+
+	count, err = s.DbMap.SelectInt("SELECT COUNT(*) FROM sqlite_master WHERE type='table'")
+	c.Assert(err, IsNil)
+	c.Assert(count, Equals, int64(2))
+}
+
 func (s *SqliteMigrateSuite) TestContextTimeout(c *C) {
 	// This statement will run for a long time: 1,000,000 iterations of the fibonacci sequence
 	fibonacciLoopStmt := `WITH RECURSIVE
@@ -813,6 +1263,36 @@ func (s *SqliteMigrateSuite) TestContextTimeout(c *C) {
 	c.Assert(n, Equals, 2)
 }
 
+// cancelAfterStatements cancels the run once its statements were executed.
+type cancelAfterStatements struct {
+	noInstrumentation
+	cancel context.CancelFunc
+}
+
+func (i cancelAfterStatements) EndStatement(context.Context, StatementInfo, int64, error) {
+	i.cancel()
+}
+
+func (s *SqliteMigrateSuite) TestExecContextCanceledBeforeRecord(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: sqliteMigrations[:1],
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ms := MigrationSet{Instrumentation: cancelAfterStatements{cancel: cancel}}
+	n, err := ms.ExecContext(ctx, s.Db, "sqlite3", migrations, Up)
+	c.Assert(errors.Is(err, context.Canceled), Equals, true)
+	c.Assert(n, Equals, 0)
+
+	// The statement was rolled back along with the record.
+	records, err := ms.GetMigrationRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 0)
+	_, err = s.DbMap.Exec("SELECT * FROM people")
+	c.Assert(err, NotNil)
+}
+
 //go:embed test-migrations/*
 var testEmbedFS embed.FS
 
@@ -832,3 +1312,260 @@ func (s *SqliteMigrateSuite) TestEmbedSource(c *C) {
 	c.Assert(err, IsNil)
 	c.Assert(id, Equals, int64(1))
 }
+
+func (s *SqliteMigrateSuite) TestExecTarget(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			{
+				Id:   "1_create_table.sql",
+				Up:   []string{"CREATE TABLE people (id int)"},
+				Down: []string{"DROP TABLE people"},
+			},
+			{
+				Id:   "2_alter_table.sql",
+				Up:   []string{"ALTER TABLE people ADD COLUMN first_name text"},
+				Down: []string{"SELECT 0"}, // Not really supported
+			},
+			{
+				Id:   "add_last_name.sql",
+				Up:   []string{"ALTER TABLE people ADD COLUMN last_name text"},
+				Down: []string{"ALTER TABLE people DROP COLUMN last_name"},
+			},
+		},
+	}
+
+	// Up to a numeric version
+	n, err := ExecTarget(s.Db, "sqlite3", migrations, "1")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	// Up to a full id without a version
+	planned, dir, _, err := PlanMigrationToTarget(s.Db, "sqlite3", migrations, "add_last_name.sql")
+	c.Assert(err, IsNil)
+	c.Assert(dir, Equals, Up)
+	c.Assert(planned, HasLen, 2)
+	c.Assert(planned[0].Id, Equals, "2_alter_table.sql")
+	c.Assert(planned[1].Id, Equals, "add_last_name.sql")
+
+	n, err = ExecTarget(s.Db, "sqlite3", migrations, "add_last_name.sql")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	_, err = s.DbMap.Exec("SELECT last_name FROM people")
+	c.Assert(err, IsNil)
+
+	// Back down to a full id
+	planned, dir, _, err = PlanMigrationToTarget(s.Db, "sqlite3", migrations, "1_create_table.sql")
+	c.Assert(err, IsNil)
+	c.Assert(dir, Equals, Down)
+	c.Assert(planned, HasLen, 2)
+	c.Assert(planned[0].Id, Equals, "add_last_name.sql")
+	c.Assert(planned[1].Id, Equals, "2_alter_table.sql")
+
+	// Nothing to do when at the target
+	n, err = ExecTarget(s.Db, "sqlite3", migrations, "add_last_name.sql")
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 0)
+}
+
+func (s *SqliteMigrateSuite) TestExecTargetTime(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: sqliteMigrations[:2],
+	}
+
+	n, err := ExecMax(s.Db, "sqlite3", migrations, Up, 1)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	between := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	n, err = Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	// Reverts everything applied after the point in time
+	planned, dir, _, err := PlanMigrationToTarget(s.Db, "sqlite3", migrations, between.Format(time.RFC3339Nano))
+	c.Assert(err, IsNil)
+	c.Assert(dir, Equals, Down)
+	c.Assert(planned, HasLen, 1)
+	c.Assert(planned[0].Id, Equals, "124")
+
+	// Before anything was applied
+	planned, dir, _, err = PlanMigrationToTarget(s.Db, "sqlite3", migrations, "2000-01-01")
+	c.Assert(err, IsNil)
+	c.Assert(dir, Equals, Down)
+	c.Assert(planned, HasLen, 2)
+}
+
+func (s *SqliteMigrateSuite) TestExecTargetUnknown(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			{Id: "1_a.sql", Up: []string{"SELECT 0"}},
+			{Id: "1_b.sql", Up: []string{"SELECT 0"}},
+			{Id: "abc.sql", Up: []string{"SELECT 0"}},
+		},
+	}
+
+	_, err := ExecTarget(s.Db, "sqlite3", migrations, "2")
+	c.Assert(err, FitsTypeOf, &PlanError{})
+
+	_, err = ExecTarget(s.Db, "sqlite3", migrations, "1")
+	c.Assert(err, ErrorMatches, ".*ambiguous.*")
+
+	_, err = ExecTarget(s.Db, "sqlite3", migrations, "def.sql")
+	c.Assert(err, FitsTypeOf, &PlanError{})
+}
+
+func (s *SqliteMigrateSuite) TestMigrateVersionWithoutNumericIds(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			{Id: "1_a.sql", Up: []string{"SELECT 0"}, Down: []string{"SELECT 1"}},
+			{Id: "abc.sql", Up: []string{"SELECT 0"}, Down: []string{"SELECT 1"}},
+		},
+	}
+
+	// Should not panic on the id without a version
+	_, err := ExecVersion(s.Db, "sqlite3", migrations, Up, 2)
+	c.Assert(err, FitsTypeOf, &PlanError{})
+
+	n, err := Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	n, err = ExecVersion(s.Db, "sqlite3", migrations, Down, 1)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+}
+
+func (s *SqliteMigrateSuite) TestRenameMigrationRecords(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: sqliteMigrations[:2],
+	}
+
+	n, err := Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	// Refuses to rename onto an applied migration, without renaming anything
+	err = RenameMigrationRecords(s.Db, "sqlite3", map[string]string{"123": "1", "124": "123"})
+	c.Assert(err, NotNil)
+
+	err = RenameMigrationRecords(s.Db, "sqlite3", map[string]string{"125": "2"})
+	c.Assert(err, NotNil)
+
+	err = RenameMigrationRecords(s.Db, "sqlite3", map[string]string{"123": "1", "124": "2"})
+	c.Assert(err, IsNil)
+
+	records, err := GetMigrationRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 2)
+	c.Assert(records[0].Id, Equals, "1")
+	c.Assert(records[1].Id, Equals, "2")
+}
+
+func (s *SqliteMigrateSuite) TestSquashedMigrations(c *C) {
+	originals := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			{Id: "1_create.sql", Up: []string{"CREATE TABLE people (id int)"}, Down: []string{"DROP TABLE people"}},
+			{Id: "2_alter.sql", Up: []string{"ALTER TABLE people ADD COLUMN first_name text"}, Down: []string{"SELECT 0"}},
+			{Id: "3_alter.sql", Up: []string{"ALTER TABLE people ADD COLUMN last_name text"}, Down: []string{"SELECT 0"}},
+		},
+	}
+	squashed := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			{
+				Id:       "2_squashed.sql",
+				Up:       []string{"CREATE TABLE people (id int, first_name text)"},
+				Squashes: []string{"1_create.sql", "2_alter.sql"},
+			},
+			originals.Migrations[2],
+		},
+	}
+
+	// Applied the originals, counts as having applied the squashed migration
+	n, err := ExecMax(s.Db, "sqlite3", originals, Up, 2)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	planned, _, err := PlanMigration(s.Db, "sqlite3", squashed, Up, 0)
+	c.Assert(err, IsNil)
+	c.Assert(planned, HasLen, 1)
+	c.Assert(planned[0].Id, Equals, "3_alter.sql")
+
+	n, err = Exec(s.Db, "sqlite3", squashed, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	// Reverting the squashed migration removes the records of the originals
+	n, err = Exec(s.Db, "sqlite3", squashed, Down)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	records, err := GetMigrationRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 0)
+}
+
+func (s *SqliteMigrateSuite) TestSquashedMigrationsAppliedSquashed(c *C) {
+	squashed := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			{Id: "1_create.sql", Up: []string{"SELECT 1"}},
+			{Id: "2_alter.sql", Up: []string{"SELECT 2"}},
+			{Id: "2_squashed.sql", Up: []string{"SELECT 0"}, Squashes: []string{"1_create.sql", "2_alter.sql"}},
+		},
+	}
+
+	// The originals are left out when the squashed migration is around
+	n, err := Exec(s.Db, "sqlite3", squashed, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	planned, _, err := PlanMigration(s.Db, "sqlite3", squashed, Up, 0)
+	c.Assert(err, IsNil)
+	c.Assert(planned, HasLen, 0)
+}
+
+func (s *SqliteMigrateSuite) TestSquashedMigrationsPartiallyApplied(c *C) {
+	originals := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			{Id: "1_create.sql", Up: []string{"SELECT 1"}},
+			{Id: "2_alter.sql", Up: []string{"SELECT 2"}},
+		},
+	}
+	squashed := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			{Id: "2_squashed.sql", Up: []string{"SELECT 0"}, Squashes: []string{"1_create.sql", "2_alter.sql"}},
+		},
+	}
+
+	n, err := ExecMax(s.Db, "sqlite3", originals, Up, 1)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	_, _, err = PlanMigration(s.Db, "sqlite3", squashed, Up, 0)
+	c.Assert(err, FitsTypeOf, &PlanError{})
+}
+
+func (s *SqliteMigrateSuite) TestSquashedMigrationsNested(c *C) {
+	first := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			{Id: "2_squashed.sql", Up: []string{"SELECT 0"}, Squashes: []string{"1_create.sql", "2_alter.sql"}},
+			{Id: "3_alter.sql", Up: []string{"SELECT 3"}},
+		},
+	}
+	second := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			{Id: "3_squashed.sql", Up: []string{"SELECT 0"}, Squashes: []string{"1_create.sql", "2_alter.sql", "2_squashed.sql", "3_alter.sql"}},
+		},
+	}
+
+	// Applied the first squashed migration, but not its originals
+	n, err := Exec(s.Db, "sqlite3", first, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	planned, _, err := PlanMigration(s.Db, "sqlite3", second, Up, 0)
+	c.Assert(err, IsNil)
+	c.Assert(planned, HasLen, 0)
+}
@@ -0,0 +1,236 @@
+// Package migratetest checks that migrations can be undone and redone.
+//
+// Use it from a regular test:
+//
+//	func TestMigrations(t *testing.T) {
+//		migratetest.CheckReversible(t, migrate.FileMigrationSource{Dir: "migrations"}, nil)
+//	}
+//
+// Every migration is applied, undone and applied again, one by one. After each
+// step the schema is read from the database catalog. The test fails when a Down
+// migration doesn't bring back the schema from before its Up migration, or when
+// an Up migration can't be applied again after being undone.
+package migratetest
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	// The default database is an in-memory sqlite3 database.
+	_ "github.com/mattn/go-sqlite3"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+// TableName is the name of the table used to store migration info while testing.
+const TableName = "migratetest_migrations"
+
+// Config sets the database the migrations are tested against. The zero value
+// uses an in-memory sqlite3 database.
+type Config struct {
+	// Dialect of the database, eg: sqlite3, postgres or mysql.
+	Dialect string
+
+	// Open returns an empty database to run the migrations in. It is closed
+	// when the test is done.
+	Open func() (*sql.DB, error)
+
+	// Snapshot reads the schema of the database. It defaults to catalog
+	// queries for the dialect, which are available for sqlite3, postgres and
+	// mysql. The migration table should be left out.
+	Snapshot func(db *sql.DB) (Schema, error)
+}
+
+// Schema describes the objects in a database, one line per table column,
+// index or other object. The lines are sorted.
+type Schema []string
+
+// Diff returns the lines that are only in s, prefixed by "-", and the lines
+// that are only in other, prefixed by "+".
+func (s Schema) Diff(other Schema) []string {
+	var diff []string
+	for _, line := range s {
+		if !slices.Contains(other, line) {
+			diff = append(diff, "- "+line)
+		}
+	}
+	for _, line := range other {
+		if !slices.Contains(s, line) {
+			diff = append(diff, "+ "+line)
+		}
+	}
+	return diff
+}
+
+// CheckReversible applies, undoes and applies again each migration from the source, and
+// fails the test when that doesn't work or when the schema is not restored.
+// Irreversible migrations are only applied.
+// The config may be nil to test against an in-memory sqlite3 database.
+func CheckReversible(t testing.TB, source migrate.MigrationSource, config *Config) {
+	t.Helper()
+
+	if config == nil {
+		config = &Config{}
+	}
+
+	db, dialect, err := config.open()
+	if err != nil {
+		t.Fatalf("Cannot open database: %s", err)
+	}
+	defer db.Close()
+
+	for _, err := range check(db, dialect, source, config.snapshot(dialect)) {
+		t.Error(err)
+	}
+}
+
+func (c *Config) open() (*sql.DB, string, error) {
+	if c.Open == nil {
+		db, err := sql.Open("sqlite3", ":memory:")
+		if err != nil {
+			return nil, "", err
+		}
+		// Every connection gets its own in-memory database.
+		db.SetMaxOpenConns(1)
+		return db, "sqlite3", nil
+	}
+
+	dialect := c.Dialect
+	if dialect == "" {
+		return nil, "", fmt.Errorf("No dialect specified")
+	}
+	db, err := c.Open()
+	return db, dialect, err
+}
+
+func (c *Config) snapshot(dialect string) func(db *sql.DB) (Schema, error) {
+	if c.Snapshot != nil {
+		return c.Snapshot
+	}
+	return func(db *sql.DB) (Schema, error) {
+		return SnapshotSchema(db, dialect)
+	}
+}
+
+// Steps through all migrations and returns everything that went wrong. It stops
+// at the first migration that can't be applied. Irreversible migrations are
+// only applied.
+func check(db *sql.DB, dialect string, source migrate.MigrationSource, snapshot func(db *sql.DB) (Schema, error)) []error {
+	ms := migrate.MigrationSet{TableName: TableName}
+
+	migrations, err := source.FindMigrations()
+	if err != nil {
+		return []error{err}
+	}
+
+	var errs []error
+	for _, m := range migrations {
+		before, err := snapshot(db)
+		if err != nil {
+			return append(errs, err)
+		}
+
+		if _, err := ms.ExecMax(db, dialect, source, migrate.Up, 1); err != nil {
+			return append(errs, fmt.Errorf("%s: Up failed: %w", m.Id, err))
+		}
+		if m.Irreversible {
+			continue
+		}
+		after, err := snapshot(db)
+		if err != nil {
+			return append(errs, err)
+		}
+
+		if _, err := ms.ExecMax(db, dialect, source, migrate.Down, 1); err != nil {
+			return append(errs, fmt.Errorf("%s: Down failed: %w", m.Id, err))
+		}
+		undone, err := snapshot(db)
+		if err != nil {
+			return append(errs, err)
+		}
+		restored := true
+		if diff := before.Diff(undone); len(diff) > 0 {
+			errs = append(errs, fmt.Errorf("%s: Down doesn't restore the schema:\n%s", m.Id, strings.Join(diff, "\n")))
+			restored = false
+		}
+
+		if _, err := ms.ExecMax(db, dialect, source, migrate.Up, 1); err != nil {
+			return append(errs, fmt.Errorf("%s: Up failed after Down: %w", m.Id, err))
+		}
+		redone, err := snapshot(db)
+		if err != nil {
+			return append(errs, err)
+		}
+		// Whatever Down left behind would show up again here.
+		if diff := after.Diff(redone); restored && len(diff) > 0 {
+			errs = append(errs, fmt.Errorf("%s: Up after Down gives a different schema:\n%s", m.Id, strings.Join(diff, "\n")))
+		}
+	}
+
+	return errs
+}
+
+// The migration table and the table with the checksums of its migrations.
+const migrationTables = "'" + TableName + "', '" + TableName + "_checksums'"
+
+var snapshotQueries = map[string][]string{
+	"sqlite3": {
+		`SELECT type, tbl_name, name, COALESCE(sql, '') FROM sqlite_master
+		WHERE name NOT LIKE 'sqlite_%' AND tbl_name NOT IN (` + migrationTables + `)`,
+	},
+	"postgres": {
+		`SELECT 'column', table_name, column_name, data_type || ' ' || is_nullable || ' ' || COALESCE(column_default, '')
+		FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name NOT IN (` + migrationTables + `)`,
+		`SELECT 'index', tablename, indexname, indexdef FROM pg_indexes
+		WHERE schemaname = current_schema() AND tablename NOT IN (` + migrationTables + `)`,
+		`SELECT 'view', table_name, '', COALESCE(view_definition, '') FROM information_schema.views
+		WHERE table_schema = current_schema()`,
+		`SELECT 'sequence', sequence_name, '', data_type FROM information_schema.sequences
+		WHERE sequence_schema = current_schema()`,
+	},
+	"mysql": {
+		`SELECT 'column', table_name, column_name, CONCAT(column_type, ' ', is_nullable, ' ', COALESCE(column_default, ''))
+		FROM information_schema.columns
+		WHERE table_schema = DATABASE() AND table_name NOT IN (` + migrationTables + `)`,
+		`SELECT 'index', table_name, index_name, CONCAT(seq_in_index, ' ', column_name, ' ', non_unique)
+		FROM information_schema.statistics
+		WHERE table_schema = DATABASE() AND table_name NOT IN (` + migrationTables + `)`,
+	},
+}
+
+// SnapshotSchema reads the schema of a database from its catalog, leaving out
+// the migration tables. Supported dialects are sqlite3, postgres and mysql.
+func SnapshotSchema(db *sql.DB, dialect string) (Schema, error) {
+	queries, ok := snapshotQueries[dialect]
+	if !ok {
+		return nil, fmt.Errorf("Cannot read the schema for dialect %s, set Config.Snapshot", dialect)
+	}
+
+	var schema Schema
+	for _, query := range queries {
+		rows, err := db.Query(query)
+		if err != nil {
+			return nil, fmt.Errorf("Cannot read schema: %w", err)
+		}
+		for rows.Next() {
+			var kind, table, name, definition string
+			if err := rows.Scan(&kind, &table, &name, &definition); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			schema = append(schema, fmt.Sprintf("%s %s %s: %s", kind, table, name, definition))
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	slices.Sort(schema)
+	return schema, nil
+}
@@ -0,0 +1,92 @@
+package migratetest
+
+import (
+	"testing"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type MigrateTestSuite struct{}
+
+var _ = Suite(&MigrateTestSuite{})
+
+func (*MigrateTestSuite) check(c *C, source migrate.MigrationSource) []error {
+	db, dialect, err := (&Config{}).open()
+	c.Assert(err, IsNil)
+	defer db.Close()
+
+	return check(db, dialect, source, (&Config{}).snapshot(dialect))
+}
+
+func (s *MigrateTestSuite) TestReversible(c *C) {
+	errs := s.check(c, migrate.FileMigrationSource{Dir: "../test-migrations"})
+	c.Assert(errs, HasLen, 0)
+}
+
+func (s *MigrateTestSuite) TestDownDoesNotRestore(c *C) {
+	errs := s.check(c, &migrate.MemoryMigrationSource{
+		Migrations: []*migrate.Migration{
+			{
+				Id:   "1_people.sql",
+				Up:   []string{"CREATE TABLE people (id int)"},
+				Down: []string{"DROP TABLE people"},
+			},
+			{
+				Id:   "2_index.sql",
+				Up:   []string{"CREATE INDEX people_id ON people (id)"},
+				Down: []string{"DROP INDEX people_id", "CREATE TABLE leftover (id int)"},
+			},
+		},
+	})
+	c.Assert(errs, HasLen, 1)
+	c.Assert(errs[0], ErrorMatches, `(?s)2_index.sql: Down doesn't restore the schema:\n\+ table leftover leftover: .*`)
+}
+
+func (s *MigrateTestSuite) TestUpNotRerunnable(c *C) {
+	errs := s.check(c, &migrate.MemoryMigrationSource{
+		Migrations: []*migrate.Migration{
+			{
+				Id:   "1_people.sql",
+				Up:   []string{"CREATE TABLE people (id int)"},
+				Down: []string{"SELECT 1"},
+			},
+		},
+	})
+	c.Assert(errs, HasLen, 2)
+	c.Assert(errs[0], ErrorMatches, `(?s)1_people.sql: Down doesn't restore the schema:.*`)
+	c.Assert(errs[1], ErrorMatches, `1_people.sql: Up failed after Down: .*already exists.*`)
+}
+
+func (s *MigrateTestSuite) TestIrreversible(c *C) {
+	errs := s.check(c, &migrate.MemoryMigrationSource{
+		Migrations: []*migrate.Migration{
+			{
+				Id:           "1_baseline.sql",
+				Up:           []string{"CREATE TABLE people (id int)"},
+				Irreversible: true,
+			},
+			{
+				Id:   "2_pets.sql",
+				Up:   []string{"CREATE TABLE pets (id int)"},
+				Down: []string{"SELECT 1"},
+			},
+		},
+	})
+
+	// The migration after the irreversible one is still checked.
+	c.Assert(errs, HasLen, 2)
+	c.Assert(errs[0], ErrorMatches, `(?s)2_pets.sql: Down doesn't restore the schema:.*`)
+	c.Assert(errs[1], ErrorMatches, `2_pets.sql: Up failed after Down: .*already exists.*`)
+}
+
+func (*MigrateTestSuite) TestSchemaDiff(c *C) {
+	before := Schema{"table a", "table b"}
+	after := Schema{"table b", "table c"}
+	c.Assert(before.Diff(after), DeepEquals, []string{"- table a", "+ table c"})
+	c.Assert(before.Diff(before), HasLen, 0)
+}
@@ -0,0 +1,206 @@
+// Package otelmigrate traces migrations and records metrics about them with
+// OpenTelemetry.
+//
+// Set it as the instrumentation of a MigrationSet:
+//
+//	instrumentation, err := otelmigrate.New(otelmigrate.Config{})
+//	if err != nil {
+//		return err
+//	}
+//	ms := migrate.MigrationSet{Instrumentation: instrumentation}
+//	n, err := ms.ExecContext(ctx, db, "postgres", migrations, migrate.Up)
+//
+// Every run gets a span, with a child span for each migration, which in turn
+// has a child span for each statement. Errors are recorded on the spans.
+//
+// The following metrics are recorded:
+//
+//   - migrate.migrations.applied: the number of applied migrations
+//   - migrate.migrations.failed: the number of migrations that failed
+//   - migrate.migration.duration: how long migrations took, in seconds
+//   - migrate.statement.duration: how long statements took, in seconds
+package otelmigrate
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+// ScopeName is the instrumentation scope of the tracer and meter.
+const ScopeName = "github.com/rubenv/sql-migrate/otelmigrate"
+
+// Attributes of the spans and metrics.
+const (
+	DirectionKey    = attribute.Key("migrate.direction")
+	MigrationsKey   = attribute.Key("migrate.migrations")
+	AppliedKey      = attribute.Key("migrate.applied")
+	MigrationIdKey  = attribute.Key("migrate.migration.id")
+	TransactionKey  = attribute.Key("migrate.migration.transaction")
+	StatementKey    = attribute.Key("migrate.statement.index")
+	LineKey         = attribute.Key("migrate.statement.line")
+	RowsAffectedKey = attribute.Key("migrate.statement.rows_affected")
+	ErrorCodeKey    = attribute.Key("db.response.status_code")
+	ResultKey       = attribute.Key("migrate.result")
+)
+
+// Config sets where the spans and metrics go. The zero value uses the global
+// providers.
+type Config struct {
+	TracerProvider trace.TracerProvider
+	MeterProvider  metric.MeterProvider
+}
+
+// Instrumentation implements migrate.Instrumentation.
+type Instrumentation struct {
+	tracer trace.Tracer
+
+	applied           metric.Int64Counter
+	failed            metric.Int64Counter
+	migrationDuration metric.Float64Histogram
+	statementDuration metric.Float64Histogram
+}
+
+var _ migrate.Instrumentation = (*Instrumentation)(nil)
+
+// New returns an Instrumentation that uses the providers of config.
+func New(config Config) (*Instrumentation, error) {
+	tracerProvider := config.TracerProvider
+	if tracerProvider == nil {
+		tracerProvider = otel.GetTracerProvider()
+	}
+	meterProvider := config.MeterProvider
+	if meterProvider == nil {
+		meterProvider = otel.GetMeterProvider()
+	}
+
+	i := &Instrumentation{
+		tracer: tracerProvider.Tracer(ScopeName),
+	}
+	meter := meterProvider.Meter(ScopeName)
+
+	var err error
+	i.applied, err = meter.Int64Counter("migrate.migrations.applied",
+		metric.WithDescription("Number of applied migrations."),
+		metric.WithUnit("{migration}"))
+	if err != nil {
+		return nil, err
+	}
+	i.failed, err = meter.Int64Counter("migrate.migrations.failed",
+		metric.WithDescription("Number of migrations that failed."),
+		metric.WithUnit("{migration}"))
+	if err != nil {
+		return nil, err
+	}
+	i.migrationDuration, err = meter.Float64Histogram("migrate.migration.duration",
+		metric.WithDescription("Duration of migrations."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+	i.statementDuration, err = meter.Float64Histogram("migrate.statement.duration",
+		metric.WithDescription("Duration of the statements of migrations."),
+		metric.WithUnit("s"))
+	if err != nil {
+		return nil, err
+	}
+
+	return i, nil
+}
+
+// The start time of the innermost run, migration or statement.
+type startKey struct{}
+
+func started(ctx context.Context) context.Context {
+	return context.WithValue(ctx, startKey{}, time.Now())
+}
+
+func elapsed(ctx context.Context) float64 {
+	start, ok := ctx.Value(startKey{}).(time.Time)
+	if !ok {
+		return 0
+	}
+	return time.Since(start).Seconds()
+}
+
+func result(err error) attribute.KeyValue {
+	if err != nil {
+		return ResultKey.String("error")
+	}
+	return ResultKey.String("ok")
+}
+
+// Ends the span of ctx, recording err.
+func endSpan(ctx context.Context, err error) {
+	span := trace.SpanFromContext(ctx)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		if code := migrate.DatabaseErrorCode(err); code != "" {
+			span.SetAttributes(ErrorCodeKey.String(code))
+		}
+	}
+	span.End()
+}
+
+func (i *Instrumentation) StartRun(ctx context.Context, run migrate.RunInfo) context.Context {
+	ctx, _ = i.tracer.Start(ctx, "sql-migrate run", trace.WithAttributes(
+		DirectionKey.String(run.Direction.String()),
+		MigrationsKey.Int(run.Migrations),
+	))
+	return ctx
+}
+
+func (*Instrumentation) EndRun(ctx context.Context, _ migrate.RunInfo, applied int, err error) {
+	trace.SpanFromContext(ctx).SetAttributes(AppliedKey.Int(applied))
+	endSpan(ctx, err)
+}
+
+func (i *Instrumentation) StartMigration(ctx context.Context, migration migrate.MigrationInfo) context.Context {
+	ctx, _ = i.tracer.Start(ctx, "sql-migrate migration", trace.WithAttributes(
+		MigrationIdKey.String(migration.Id),
+		DirectionKey.String(migration.Direction.String()),
+		TransactionKey.Bool(migration.Transaction),
+	))
+	return started(ctx)
+}
+
+func (i *Instrumentation) EndMigration(ctx context.Context, migration migrate.MigrationInfo, err error) {
+	direction := DirectionKey.String(migration.Direction.String())
+	if err != nil {
+		i.failed.Add(ctx, 1, metric.WithAttributes(direction))
+	} else {
+		i.applied.Add(ctx, 1, metric.WithAttributes(direction))
+	}
+	i.migrationDuration.Record(ctx, elapsed(ctx), metric.WithAttributes(direction, result(err)))
+	endSpan(ctx, err)
+}
+
+func (i *Instrumentation) StartStatement(ctx context.Context, statement migrate.StatementInfo) context.Context {
+	attributes := []attribute.KeyValue{
+		MigrationIdKey.String(statement.MigrationId),
+		DirectionKey.String(statement.Direction.String()),
+		StatementKey.Int(statement.Index),
+	}
+	if statement.Position.StartLine > 0 {
+		attributes = append(attributes, LineKey.Int(statement.Position.StartLine))
+	}
+	ctx, _ = i.tracer.Start(ctx, "sql-migrate statement", trace.WithAttributes(attributes...))
+	return started(ctx)
+}
+
+func (i *Instrumentation) EndStatement(ctx context.Context, statement migrate.StatementInfo, rowsAffected int64, err error) {
+	if rowsAffected >= 0 {
+		trace.SpanFromContext(ctx).SetAttributes(RowsAffectedKey.Int64(rowsAffected))
+	}
+	direction := DirectionKey.String(statement.Direction.String())
+	i.statementDuration.Record(ctx, elapsed(ctx), metric.WithAttributes(direction, result(err)))
+	endSpan(ctx, err)
+}
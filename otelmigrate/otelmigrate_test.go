@@ -0,0 +1,150 @@
+package otelmigrate
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+func Test(t *testing.T) { TestingT(t) }
+
+type OtelMigrateSuite struct {
+	Db       *sql.DB
+	Exporter *tracetest.InMemoryExporter
+	Reader   *sdkmetric.ManualReader
+	Set      migrate.MigrationSet
+}
+
+var _ = Suite(&OtelMigrateSuite{})
+
+func (s *OtelMigrateSuite) SetUpTest(c *C) {
+	var err error
+	s.Db, err = sql.Open("sqlite3", ":memory:")
+	c.Assert(err, IsNil)
+
+	s.Exporter = tracetest.NewInMemoryExporter()
+	s.Reader = sdkmetric.NewManualReader()
+	instrumentation, err := New(Config{
+		TracerProvider: sdktrace.NewTracerProvider(sdktrace.WithSyncer(s.Exporter)),
+		MeterProvider:  sdkmetric.NewMeterProvider(sdkmetric.WithReader(s.Reader)),
+	})
+	c.Assert(err, IsNil)
+	s.Set = migrate.MigrationSet{Instrumentation: instrumentation}
+}
+
+func (s *OtelMigrateSuite) TearDownTest(c *C) {
+	c.Assert(s.Db.Close(), IsNil)
+}
+
+// Returns the attributes of a span as a map.
+func attributes(span tracetest.SpanStub) map[attribute.Key]attribute.Value {
+	result := make(map[attribute.Key]attribute.Value)
+	for _, kv := range span.Attributes {
+		result[kv.Key] = kv.Value
+	}
+	return result
+}
+
+// Returns the exported spans with the given name.
+func (s *OtelMigrateSuite) spans(name string) []tracetest.SpanStub {
+	var result []tracetest.SpanStub
+	for _, span := range s.Exporter.GetSpans() {
+		if span.Name == name {
+			result = append(result, span)
+		}
+	}
+	return result
+}
+
+// Returns the sum of a counter.
+func (s *OtelMigrateSuite) sum(c *C, name string) int64 {
+	var data metricdata.ResourceMetrics
+	c.Assert(s.Reader.Collect(context.Background(), &data), IsNil)
+	var total int64
+	for _, scope := range data.ScopeMetrics {
+		for _, m := range scope.Metrics {
+			if m.Name != name {
+				continue
+			}
+			for _, point := range m.Data.(metricdata.Sum[int64]).DataPoints {
+				total += point.Value
+			}
+		}
+	}
+	return total
+}
+
+func (s *OtelMigrateSuite) TestSpans(c *C) {
+	migrations := &migrate.MemoryMigrationSource{
+		Migrations: []*migrate.Migration{
+			{
+				Id:   "1_people.sql",
+				Up:   []string{"CREATE TABLE people (id int)", "INSERT INTO people VALUES (1), (2)"},
+				Down: []string{"DROP TABLE people"},
+			},
+		},
+	}
+
+	n, err := s.Set.Exec(s.Db, "sqlite3", migrations, migrate.Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	runs := s.spans("sql-migrate run")
+	c.Assert(runs, HasLen, 1)
+	c.Assert(attributes(runs[0])[DirectionKey].AsString(), Equals, "up")
+	c.Assert(attributes(runs[0])[AppliedKey].AsInt64(), Equals, int64(1))
+
+	migrationSpans := s.spans("sql-migrate migration")
+	c.Assert(migrationSpans, HasLen, 1)
+	c.Assert(migrationSpans[0].Parent.SpanID(), Equals, runs[0].SpanContext.SpanID())
+	c.Assert(attributes(migrationSpans[0])[MigrationIdKey].AsString(), Equals, "1_people.sql")
+	c.Assert(attributes(migrationSpans[0])[TransactionKey].AsBool(), Equals, true)
+
+	statements := s.spans("sql-migrate statement")
+	c.Assert(statements, HasLen, 2)
+	for i, statement := range statements {
+		c.Assert(statement.Parent.SpanID(), Equals, migrationSpans[0].SpanContext.SpanID())
+		c.Assert(attributes(statement)[StatementKey].AsInt64(), Equals, int64(i))
+	}
+	c.Assert(attributes(statements[1])[RowsAffectedKey].AsInt64(), Equals, int64(2))
+
+	c.Assert(s.sum(c, "migrate.migrations.applied"), Equals, int64(1))
+	c.Assert(s.sum(c, "migrate.migrations.failed"), Equals, int64(0))
+}
+
+func (s *OtelMigrateSuite) TestFailure(c *C) {
+	migrations := &migrate.MemoryMigrationSource{
+		Migrations: []*migrate.Migration{
+			{
+				Id: "1_fail.sql",
+				Up: []string{"SELECT * FROM nope"},
+			},
+		},
+	}
+
+	_, err := s.Set.Exec(s.Db, "sqlite3", migrations, migrate.Up)
+	c.Assert(err, NotNil)
+
+	for _, name := range []string{"sql-migrate run", "sql-migrate migration", "sql-migrate statement"} {
+		spans := s.spans(name)
+		c.Assert(spans, HasLen, 1)
+		c.Assert(spans[0].Status.Code, Equals, codes.Error)
+		c.Assert(spans[0].Events, Not(HasLen), 0)
+	}
+
+	c.Assert(s.sum(c, "migrate.migrations.applied"), Equals, int64(0))
+	c.Assert(s.sum(c, "migrate.migrations.failed"), Equals, int64(1))
+}
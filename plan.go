@@ -0,0 +1,200 @@
+package migrate
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/go-gorp/gorp/v3"
+
+	"github.com/rubenv/sql-migrate/internal/errs"
+)
+
+// MigrationPlanVersion is the version of the MigrationPlan format.
+const MigrationPlanVersion = 1
+
+// A MigrationPlan is a migration plan that can be stored, for example as JSON,
+// and executed later with ExecPlan.
+//
+// It records the exact statements to run and a fingerprint of the migrations
+// that had been applied when it was created. ExecPlan refuses to run it when
+// the database or the migrations changed in the meantime.
+type MigrationPlan struct {
+	Version            int                  `json:"version"`
+	Dialect            string               `json:"dialect"`
+	HistoryFingerprint string               `json:"history_fingerprint"`
+	Steps              []*MigrationPlanStep `json:"steps"`
+}
+
+// A MigrationPlanStep applies a single migration in one direction.
+type MigrationPlanStep struct {
+	Id                 string             `json:"id"`
+	Direction          MigrationDirection `json:"direction"`
+	Checksum           string             `json:"checksum"`
+	DisableTransaction bool               `json:"disable_transaction"`
+	Queries            []string           `json:"queries"`
+}
+
+// Create a migration plan that can be executed later, see MigrationPlan.
+func CreatePlan(db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection, max int) (*MigrationPlan, error) {
+	return migSet.CreatePlan(db, dialect, m, dir, max)
+}
+
+// Create a migration plan that can be executed later, see MigrationPlan.
+func (ms MigrationSet) CreatePlan(db *sql.DB, dialect string, m MigrationSource, dir MigrationDirection, max int) (*MigrationPlan, error) {
+	_, migrations, migrationRecords, err := ms.findMigrationsAndRecords(db, dialect, m)
+	if err != nil {
+		return nil, err
+	}
+
+	planned, err := ms.planMigrations(migrations, migrationRecords, dir, max, -1)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &MigrationPlan{
+		Version:            MigrationPlanVersion,
+		Dialect:            dialect,
+		HistoryFingerprint: historyFingerprint(migrationRecords),
+		Steps:              make([]*MigrationPlanStep, 0, len(planned)),
+	}
+	for _, migration := range planned {
+		// The plan records the statements of streamed migrations too.
+		queries, err := migration.readQueries(dir)
+		if err != nil {
+			return nil, newPlanError(migration.Migration, err)
+		}
+		plan.Steps = append(plan.Steps, &MigrationPlanStep{
+			Id:                 migration.Id,
+			Direction:          dir,
+			Checksum:           migration.Checksum(),
+			DisableTransaction: migration.DisableTransaction,
+			Queries:            queries,
+		})
+	}
+
+	return plan, nil
+}
+
+// Execute a migration plan created by CreatePlan.
+//
+// Refuses to run the plan when other migrations have been applied or reverted
+// since it was created, or when any of its migrations was changed.
+//
+// Returns the number of applied migrations.
+func ExecPlan(db *sql.DB, dialect string, m MigrationSource, plan *MigrationPlan) (int, error) {
+	return migSet.ExecPlanContext(context.Background(), db, dialect, m, plan)
+}
+
+// Execute a migration plan created by CreatePlan with an input context.
+//
+// Returns the number of applied migrations.
+func ExecPlanContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, plan *MigrationPlan) (int, error) {
+	return migSet.ExecPlanContext(ctx, db, dialect, m, plan)
+}
+
+// Returns the number of applied migrations.
+func (ms MigrationSet) ExecPlan(db *sql.DB, dialect string, m MigrationSource, plan *MigrationPlan) (int, error) {
+	return ms.ExecPlanContext(context.Background(), db, dialect, m, plan)
+}
+
+// Returns the number of applied migrations, but applies with an input context.
+func (ms MigrationSet) ExecPlanContext(ctx context.Context, db *sql.DB, dialect string, m MigrationSource, plan *MigrationPlan) (int, error) {
+	if plan.Version != MigrationPlanVersion {
+		return 0, fmt.Errorf("Unsupported migration plan version %d", plan.Version)
+	}
+	if plan.Dialect != dialect {
+		return 0, fmt.Errorf("Migration plan was created for dialect %s, not %s", plan.Dialect, dialect)
+	}
+
+	dbMap, migrations, migrationRecords, err := ms.findMigrationsAndRecords(db, dialect, m)
+	if err != nil {
+		return 0, err
+	}
+
+	if historyFingerprint(migrationRecords) != plan.HistoryFingerprint {
+		return 0, fmt.Errorf("%w: migrations were applied or reverted since it was created", ErrPlanOutOfDate)
+	}
+
+	migrationsById := make(map[string]*Migration)
+	for _, migration := range migrations {
+		migrationsById[migration.Id] = migration
+	}
+
+	planned := make([]*PlannedMigration, 0, len(plan.Steps))
+	for _, step := range plan.Steps {
+		migration, ok := migrationsById[step.Id]
+		if !ok {
+			return 0, newPlanError(&Migration{Id: step.Id}, errs.Mark(ErrPlanMismatch, "migration in plan no longer exists"))
+		}
+		if migration.Checksum() != step.Checksum {
+			return 0, newPlanError(migration, errs.Mark(ErrPlanMismatch, "migration changed since the plan was created"))
+		}
+
+		queries, err := migration.readQueries(step.Direction)
+		if err != nil {
+			return 0, newPlanError(migration, err)
+		}
+		disableTransaction := migration.DisableTransactionUp
+		if step.Direction == Down {
+			disableTransaction = migration.DisableTransactionDown
+		}
+		if !slices.Equal(queries, step.Queries) || disableTransaction != step.DisableTransaction {
+			return 0, newPlanError(migration, ErrPlanMismatch)
+		}
+
+		// A streamed migration is read again while it's executed, its
+		// statements were just checked to match the plan.
+		if migration.Stream != nil {
+			queries = nil
+		}
+		planned = append(planned, &PlannedMigration{
+			Migration:          migration,
+			Queries:            queries,
+			DisableTransaction: step.DisableTransaction,
+		})
+	}
+
+	return ms.applyPlanSteps(ctx, plan.Steps, planned, dbMap)
+}
+
+// Like applyMigrations, but each step has its own direction.
+func (ms MigrationSet) applyPlanSteps(ctx context.Context, steps []*MigrationPlanStep, planned []*PlannedMigration, dbMap *gorp.DbMap) (applied int, err error) {
+	if err := ms.createTables(dbMap); err != nil {
+		return 0, err
+	}
+
+	run := RunInfo{Direction: Up, Migrations: len(planned)}
+	if len(steps) > 0 {
+		run.Direction = steps[0].Direction
+	}
+	instrumentation := ms.instrumentation()
+	ctx = instrumentation.StartRun(ctx, run)
+	defer func() { instrumentation.EndRun(ctx, run, applied, err) }()
+
+	for i, migration := range planned {
+		if err := ms.applyMigration(ctx, steps[i].Direction, migration, dbMap); err != nil {
+			return applied, err
+		}
+		applied++
+	}
+
+	return applied, nil
+}
+
+// Returns a hash of the migrations that have been applied and when.
+func historyFingerprint(migrationRecords []MigrationRecord) string {
+	records := slices.Clone(migrationRecords)
+	sort.Slice(records, func(i, j int) bool { return records[i].Id < records[j].Id })
+
+	h := sha256.New()
+	for _, record := range records {
+		_, _ = fmt.Fprintf(h, "%s\t%s\n", record.Id, record.AppliedAt.UTC().Format(time.RFC3339Nano))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,159 @@
+package migrate
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"testing/fstest"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+)
+
+type PlanSuite struct {
+	Db *sql.DB
+}
+
+var _ = Suite(&PlanSuite{})
+
+func (s *PlanSuite) SetUpTest(c *C) {
+	var err error
+	s.Db, err = sql.Open("sqlite3", ":memory:")
+	c.Assert(err, IsNil)
+}
+
+func (s *PlanSuite) TestCreateAndExecPlan(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: sqliteMigrations[:2],
+	}
+
+	plan, err := CreatePlan(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, IsNil)
+	c.Assert(plan.Steps, HasLen, 2)
+	c.Assert(plan.Steps[0].Id, Equals, "123")
+	c.Assert(plan.Steps[0].Direction, Equals, Up)
+	c.Assert(plan.Steps[0].Queries, DeepEquals, sqliteMigrations[0].Up)
+
+	// Survives a round trip through JSON
+	data, err := json.Marshal(plan)
+	c.Assert(err, IsNil)
+	var loaded MigrationPlan
+	c.Assert(json.Unmarshal(data, &loaded), IsNil)
+	c.Assert(&loaded, DeepEquals, plan)
+
+	n, err := ExecPlan(s.Db, "sqlite3", migrations, &loaded)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	_, err = s.Db.Exec("SELECT first_name FROM people")
+	c.Assert(err, IsNil)
+
+	// Can't be applied twice, the history changed
+	_, err = ExecPlan(s.Db, "sqlite3", migrations, &loaded)
+	c.Assert(err, ErrorMatches, "Migration plan is out of date.*")
+}
+
+func (s *PlanSuite) TestPlanDown(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: sqliteMigrations[:2],
+	}
+
+	n, err := Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	plan, err := CreatePlan(s.Db, "sqlite3", migrations, Down, 0)
+	c.Assert(err, IsNil)
+	c.Assert(plan.Steps, HasLen, 2)
+	c.Assert(plan.Steps[0].Id, Equals, "124")
+	c.Assert(plan.Steps[0].Direction, Equals, Down)
+	c.Assert(plan.Steps[1].Id, Equals, "123")
+
+	n, err = ExecPlan(s.Db, "sqlite3", migrations, plan)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 2)
+
+	records, err := GetMigrationRecords(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	c.Assert(records, HasLen, 0)
+}
+
+func (s *PlanSuite) TestPlanRefusesChangedMigration(c *C) {
+	migrations := &MemoryMigrationSource{
+		Migrations: []*Migration{
+			{
+				Id:   "1",
+				Up:   []string{"CREATE TABLE people (id int)"},
+				Down: []string{"DROP TABLE people"},
+			},
+		},
+	}
+
+	plan, err := CreatePlan(s.Db, "sqlite3", migrations, Up, 0)
+	c.Assert(err, IsNil)
+
+	migrations.Migrations[0] = &Migration{
+		Id:   "1",
+		Up:   []string{"CREATE TABLE persons (id int)"},
+		Down: []string{"DROP TABLE persons"},
+	}
+	_, err = ExecPlan(s.Db, "sqlite3", migrations, plan)
+	c.Assert(err, FitsTypeOf, &PlanError{})
+
+	_, err = ExecPlan(s.Db, "postgres", migrations, plan)
+	c.Assert(err, NotNil)
+
+	// Editing the plan itself is refused too
+	migrations.Migrations[0] = &Migration{
+		Id:   "1",
+		Up:   []string{"CREATE TABLE people (id int)"},
+		Down: []string{"DROP TABLE people"},
+	}
+	plan.Steps[0].Queries = []string{"DROP TABLE people"}
+	_, err = ExecPlan(s.Db, "sqlite3", migrations, plan)
+	c.Assert(err, FitsTypeOf, &PlanError{})
+
+	n, err := Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+}
+
+func (s *PlanSuite) TestPlanStreamed(c *C) {
+	fsys := fstest.MapFS{
+		"1_initial.sql": &fstest.MapFile{Data: []byte(`-- +migrate Up
+CREATE TABLE people (id int);
+INSERT INTO people VALUES (1), (2), (3);
+
+-- +migrate Down
+DROP TABLE people;
+`)},
+	}
+	source := FSMigrationSource{FileSystem: fsys, StreamLargerThan: 1}
+
+	plan, err := CreatePlan(s.Db, "sqlite3", source, Up, 0)
+	c.Assert(err, IsNil)
+	c.Assert(plan.Steps, HasLen, 1)
+	c.Assert(plan.Steps[0].Queries, DeepEquals, []string{
+		"CREATE TABLE people (id int);\n",
+		"INSERT INTO people VALUES (1), (2), (3);\n",
+	})
+
+	// The plan is checked against the file.
+	changed := *plan.Steps[0]
+	changed.Queries = changed.Queries[:1]
+	_, err = ExecPlan(s.Db, "sqlite3", source, &MigrationPlan{
+		Version:            plan.Version,
+		Dialect:            plan.Dialect,
+		HistoryFingerprint: plan.HistoryFingerprint,
+		Steps:              []*MigrationPlanStep{&changed},
+	})
+	c.Assert(errors.Is(err, ErrPlanMismatch), Equals, true)
+
+	n, err := ExecPlan(s.Db, "sqlite3", source, plan)
+	c.Assert(err, IsNil)
+	c.Assert(n, Equals, 1)
+
+	var count int
+	c.Assert(s.Db.QueryRow("SELECT COUNT(*) FROM people").Scan(&count), IsNil)
+	c.Assert(count, Equals, 3)
+}
@@ -34,3 +34,17 @@ func (*SortSuite) TestSortMigrations(c *C) {
 	c.Assert(migrations[6].Id, Equals, "120_cde")
 	c.Assert(migrations[7].Id, Equals, "efg")
 }
+
+func (*SortSuite) TestVersion(c *C) {
+	v, err := Migration{Id: "12_abc"}.Version()
+	c.Assert(err, IsNil)
+	c.Assert(v, Equals, int64(12))
+
+	_, err = Migration{Id: "abc"}.Version()
+	c.Assert(err, NotNil)
+
+	// Doesn't fit in an int64, sorted as if it has no version
+	_, err = Migration{Id: "99999999999999999999_abc"}.Version()
+	c.Assert(err, NotNil)
+	c.Assert((Migration{Id: "1_abc"}).Less(&Migration{Id: "99999999999999999999_abc"}), Equals, true)
+}
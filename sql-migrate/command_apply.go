@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+type ApplyCommand struct{}
+
+func (*ApplyCommand) Help() string {
+	helpText := `
+Usage: sql-migrate apply [options] plan.json
+
+  Apply a migration plan created with the plan command.
+
+  Refuses to apply the plan when migrations were applied or undone since it
+  was created, or when any of the migrations in it was changed.
+
+Options:
+
+  -config=dbconfig.yml   Configuration file to use.
+  -env="development"     Environment.
+  -dialect=""            Dialect, overrides the environment.
+  -dsn=""                Data source, overrides the environment.
+  -dir=""                Migrations directory, overrides the environment.
+  -output=text           Output format: text, json or yaml. With json or yaml,
+                         exits with 2 when migrations were applied.
+  -yes                   Don't ask for confirmation in environments that require it.
+
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (*ApplyCommand) Synopsis() string {
+	return "Apply a migration plan"
+}
+
+func (c *ApplyCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("apply", flag.ContinueOnError)
+	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	ConfigFlags(cmdFlags)
+	OutputFlags(cmdFlags)
+	PolicyFlags(cmdFlags)
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if cmdFlags.NArg() != 1 {
+		ui.Error(errors.New("A plan file to apply is needed").Error())
+		return 1
+	}
+
+	return reportRun(ApplyPlan(cmdFlags.Arg(0)))
+}
+
+func ApplyPlan(file string) (*runOutput, error) {
+	output := newRunOutput("apply", false)
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return output, err
+	}
+
+	var plan migrate.MigrationPlan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return output, fmt.Errorf("Could not parse plan %s: %w", file, err)
+	}
+
+	env, err := GetEnvironment()
+	if err != nil {
+		return output, fmt.Errorf("Could not parse config: %w", err)
+	}
+
+	db, dialect, err := GetConnection(env)
+	if err != nil {
+		return output, err
+	}
+	defer db.Close()
+
+	source := GetMigrationSource(env)
+
+	// The steps of a plan all go in the same direction.
+	if len(plan.Steps) > 0 {
+		if err := checkPolicy(env, plan.Steps[0].Direction, len(plan.Steps), false); err != nil {
+			return output, err
+		}
+	}
+
+	n, err := output.migrationSet(env).ExecPlan(db, dialect, source, &plan)
+	if err != nil {
+		return output, migrationFailed(source, "Migration failed", err)
+	}
+
+	printApplied(n)
+
+	return output, nil
+}
@@ -1,79 +1,112 @@
 package main
 
 import (
+	"errors"
 	"fmt"
+	"path/filepath"
+
+	"github.com/go-gorp/gorp/v3"
 
 	migrate "github.com/rubenv/sql-migrate"
 )
 
-func ApplyMigrations(dir migrate.MigrationDirection, dryrun bool, limit int, version int64) error {
+func ApplyMigrations(dir migrate.MigrationDirection, dryrun bool, limit int, version int64) (*runOutput, error) {
+	output := newRunOutput(dir.String(), dryrun)
+
 	env, err := GetEnvironment()
 	if err != nil {
-		return fmt.Errorf("Could not parse config: %w", err)
+		return output, fmt.Errorf("Could not parse config: %w", err)
 	}
 
 	db, dialect, err := GetConnection(env)
 	if err != nil {
-		return err
+		return output, err
 	}
 	defer db.Close()
 
-	source := migrate.FileMigrationSource{
-		Dir: env.Dir,
+	source := GetMigrationSource(env)
+	ms := output.migrationSet(env)
+
+	// The policy is checked against the plan, which is then run as is.
+	var migrations []*migrate.PlannedMigration
+	var dbMap *gorp.DbMap
+	if version >= 0 {
+		migrations, dbMap, err = ms.PlanMigrationToVersion(db, dialect, source, dir, version)
+	} else {
+		migrations, dbMap, err = ms.PlanMigration(db, dialect, source, dir, limit)
+	}
+	if err != nil {
+		return output, fmt.Errorf("Cannot plan migration: %w", err)
 	}
 
-	if dryrun {
-		var migrations []*migrate.PlannedMigration
+	if err := checkPolicy(env, dir, len(migrations), dryrun); err != nil {
+		return output, err
+	}
 
-		if version >= 0 {
-			migrations, _, err = migrate.PlanMigrationToVersion(db, dialect, source, dir, version)
-		} else {
-			migrations, _, err = migrate.PlanMigration(db, dialect, source, dir, limit)
+	if dryrun {
+		for _, m := range migrations {
+			if err := output.addPlanned(m, dir); err != nil {
+				return output, err
+			}
 		}
-
+	} else {
+		n, err := ms.ExecPlanned(dbMap, dir, migrations)
 		if err != nil {
-			return fmt.Errorf("Cannot plan migration: %w", err)
+			return output, migrationFailed(source, "Migration failed", err)
 		}
 
-		for _, m := range migrations {
-			PrintMigration(m, dir)
-		}
-	} else {
-		var n int
+		printApplied(n)
+	}
 
-		if version >= 0 {
-			n, err = migrate.ExecVersion(db, dialect, source, dir, version)
-		} else {
-			n, err = migrate.ExecMax(db, dialect, source, dir, limit)
-		}
+	return output, nil
+}
 
-		if err != nil {
-			return fmt.Errorf("Migration failed: %w", err)
-		}
+// Prints the number of applied migrations in text output.
+func printApplied(n int) {
+	if OutputFormat.structured() {
+		return
+	}
 
-		if n == 1 {
-			ui.Output("Applied 1 migration")
-		} else {
-			ui.Output(fmt.Sprintf("Applied %d migrations", n))
-		}
+	if n == 1 {
+		ui.Output("Applied 1 migration")
+	} else {
+		ui.Output(fmt.Sprintf("Applied %d migrations", n))
+	}
+}
+
+// Wraps the error of a failed migration. The message starts with the file
+// and line of the failing statement when they're known, so editors can jump
+// there.
+func migrationFailed(source migrate.FileMigrationSource, message string, err error) error {
+	var txErr *migrate.TxError
+	if !errors.As(err, &txErr) || txErr.Position.StartLine == 0 {
+		return fmt.Errorf("%s: %w", message, err)
 	}
 
-	return nil
+	files, findErr := source.FindMigrationFiles()
+	file, ok := files[txErr.Migration.Id]
+	if findErr != nil || !ok {
+		return fmt.Errorf("%s: %w", message, err)
+	}
+
+	return fmt.Errorf("%s:%d: %s: %w", filepath.Join(source.Dir, file), txErr.Position.StartLine, message, err)
 }
 
 func PrintMigration(m *migrate.PlannedMigration, dir migrate.MigrationDirection) {
 	switch dir {
 	case migrate.Up:
 		ui.Output(fmt.Sprintf("==> Would apply migration %s (up)", m.Id))
-		for _, q := range m.Up {
-			ui.Output(q)
-		}
 	case migrate.Down:
 		ui.Output(fmt.Sprintf("==> Would apply migration %s (down)", m.Id))
-		for _, q := range m.Down {
-			ui.Output(q)
-		}
 	default:
 		panic("Not reached")
 	}
+
+	for stmt, err := range m.Statements(dir) {
+		if err != nil {
+			ui.Error(err.Error())
+			return
+		}
+		ui.Output(stmt.SQL)
+	}
 }
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+)
+
+type GotoCommand struct{}
+
+func (*GotoCommand) Help() string {
+	helpText := `
+Usage: sql-migrate goto [options] target
+
+  Migrates the database up or down to a target.
+
+  The target can be the full id of a migration (eg: 1_initial.sql), the
+  version number of a migration (eg: 1) or a point in time (eg:
+  2006-01-02T15:04:05Z07:00, 2006-01-02 15:04:05 or 2006-01-02). When it is a
+  point in time, all migrations applied after it are undone.
+
+Options:
+
+  -config=dbconfig.yml   Configuration file to use.
+  -env="development"     Environment.
+  -dialect=""            Dialect, overrides the environment.
+  -dsn=""                Data source, overrides the environment.
+  -dir=""                Migrations directory, overrides the environment.
+  -dryrun                Don't apply migrations, just print them.
+  -output=text           Output format: text, json or yaml. With json or yaml,
+                         exits with 2 when migrations were (or would be) applied.
+  -yes                   Don't ask for confirmation in environments that require it.
+
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (*GotoCommand) Synopsis() string {
+	return "Migrates the database up or down to a target"
+}
+
+func (c *GotoCommand) Run(args []string) int {
+	var dryrun bool
+
+	cmdFlags := flag.NewFlagSet("goto", flag.ContinueOnError)
+	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	cmdFlags.BoolVar(&dryrun, "dryrun", false, "Don't apply migrations, just print them.")
+	ConfigFlags(cmdFlags)
+	OutputFlags(cmdFlags)
+	PolicyFlags(cmdFlags)
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if cmdFlags.NArg() != 1 {
+		ui.Error(errors.New("A target to migrate to is needed").Error())
+		return 1
+	}
+
+	return reportRun(GotoMigration(cmdFlags.Arg(0), dryrun))
+}
+
+func GotoMigration(target string, dryrun bool) (*runOutput, error) {
+	output := newRunOutput("goto", dryrun)
+
+	env, err := GetEnvironment()
+	if err != nil {
+		return output, fmt.Errorf("Could not parse config: %w", err)
+	}
+
+	db, dialect, err := GetConnection(env)
+	if err != nil {
+		return output, err
+	}
+	defer db.Close()
+
+	source := GetMigrationSource(env)
+	ms := output.migrationSet(env)
+
+	// The policy is checked against the plan, which is then run as is.
+	migrations, dir, dbMap, err := ms.PlanMigrationToTarget(db, dialect, source, target)
+	if err != nil {
+		return output, fmt.Errorf("Cannot plan migration: %w", err)
+	}
+
+	if err := checkPolicy(env, dir, len(migrations), dryrun); err != nil {
+		return output, err
+	}
+
+	if dryrun {
+		for _, m := range migrations {
+			if err := output.addPlanned(m, dir); err != nil {
+				return output, err
+			}
+		}
+		return output, nil
+	}
+
+	n, err := ms.ExecPlanned(dbMap, dir, migrations)
+	if err != nil {
+		return output, migrationFailed(source, "Migration failed", err)
+	}
+
+	printApplied(n)
+
+	return output, nil
+}
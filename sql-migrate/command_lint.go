@@ -0,0 +1,185 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	migrate "github.com/rubenv/sql-migrate"
+	"github.com/rubenv/sql-migrate/sqlparse"
+)
+
+type LintCommand struct{}
+
+func (*LintCommand) Help() string {
+	helpText := `
+Usage: sql-migrate lint [options] [migration ...]
+
+  Check the Up statements of the migrations for risky patterns, such as
+  dropping tables or columns, or updating all rows at once. Only the given
+  migrations are checked, all of them when none are given.
+
+  Rules are disabled per environment with the lint.disable setting, or per
+  migration with a "-- +migrate Lint ignore=<rule>[,<rule>...]" annotation.
+
+  Exits with status 1 when problems were found.
+
+Rules:
+
+%s
+
+Options:
+
+  -config=dbconfig.yml   Configuration file to use.
+  -env="development"     Environment.
+  -dialect=""            Dialect, overrides the environment.
+  -dsn=""                Data source, overrides the environment.
+  -dir=""                Migrations directory, overrides the environment.
+  -output=text           Output format: text, json, yaml or github (workflow annotations).
+
+`
+	var rules []string
+	for _, rule := range lintRules {
+		line := fmt.Sprintf("  %-28s %s", rule.Name, rule.Message)
+		if len(rule.Dialects) > 0 {
+			line += fmt.Sprintf(" (%s only)", strings.Join(rule.Dialects, ", "))
+		}
+		rules = append(rules, line)
+	}
+	return strings.TrimSpace(fmt.Sprintf(helpText, strings.Join(rules, "\n")))
+}
+
+func (*LintCommand) Synopsis() string {
+	return "Check migrations for risky patterns"
+}
+
+func (c *LintCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("lint", flag.ContinueOnError)
+	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	ConfigFlags(cmdFlags)
+	OutputFlags(cmdFlags, outputGithub)
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	problems, err := LintMigrations(cmdFlags.Args())
+	if err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+
+	if err := printLintProblems(problems); err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+
+	if len(problems) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func LintMigrations(ids []string) ([]lintProblem, error) {
+	env, err := GetEnvironment()
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse config: %w", err)
+	}
+
+	for _, name := range env.Lint.Disable {
+		if findLintRule(name) == nil {
+			return nil, fmt.Errorf("Unknown lint rule in config: %s", name)
+		}
+	}
+
+	source := GetMigrationSource(env)
+	migrations, err := source.FindMigrations()
+	if err != nil {
+		return nil, err
+	}
+	files, err := source.FindMigrationFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		if !slices.ContainsFunc(migrations, func(m *migrate.Migration) bool { return m.Id == id }) {
+			return nil, fmt.Errorf("Unknown migration: %s", id)
+		}
+	}
+
+	options := GetParseOptions(env)
+	options.Include = migrate.IncludeFS(os.DirFS(cmp.Or(env.Dir, ".")), ".")
+
+	var problems []lintProblem
+	for _, m := range migrations {
+		if len(ids) > 0 && !slices.Contains(ids, m.Id) {
+			continue
+		}
+
+		// The statements are parsed again, the annotations the rules need
+		// are not part of a Migration.
+		file := path.Join(env.Dir, files[m.Id])
+		parsed, err := parseMigrationFile(file, options)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing migration (%s): %w", m.Id, err)
+		}
+
+		for _, name := range parsed.LintIgnore {
+			if findLintRule(name) == nil {
+				return nil, fmt.Errorf("Unknown lint rule in migration (%s): %s", m.Id, name)
+			}
+		}
+
+		problems = append(problems, lintMigration(m.Id, file, env.Dialect, parsed, env.Lint.Disable)...)
+	}
+
+	return problems, nil
+}
+
+func parseMigrationFile(file string, options sqlparse.ParseOptions) (*sqlparse.ParsedMigration, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return sqlparse.ParseMigrationWithOptions(f, options)
+}
+
+func printLintProblems(problems []lintProblem) error {
+	switch OutputFormat {
+	case outputJSON, outputYAML:
+		if problems == nil {
+			problems = []lintProblem{}
+		}
+		return writeOutput(problems)
+
+	case outputGithub:
+		for _, p := range problems {
+			message := p.Message
+			if p.Statement > 0 {
+				message = fmt.Sprintf("Up statement %d: %s", p.Statement, message)
+			}
+			location := "file=" + p.File
+			if p.Line > 0 {
+				location += fmt.Sprintf(",line=%d", p.Line)
+			}
+			ui.Output(fmt.Sprintf("::error %s,title=%s::%s", location, p.Rule, message))
+		}
+
+	default:
+		for _, p := range problems {
+			ui.Output(p.String())
+		}
+		if len(problems) == 0 {
+			ui.Output("No problems found")
+		}
+	}
+
+	return nil
+}
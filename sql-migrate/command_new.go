@@ -9,6 +9,8 @@ import (
 	"strings"
 	"text/template"
 	"time"
+
+	migrate "github.com/rubenv/sql-migrate"
 )
 
 var templateContent = `
@@ -30,6 +32,11 @@ Options:
 
   -config=dbconfig.yml   Configuration file to use.
   -env="development"     Environment.
+  -dialect=""            Dialect, overrides the environment.
+  -dsn=""                Data source, overrides the environment.
+  -dir=""                Migrations directory, overrides the environment.
+  -sequential            Number the migration after the existing ones instead of using the current time.
+  -padding=0             Zero pad sequential numbers to this width (0 = same as the last migration, or 4).
   name                   The name of the migration
 `
 	return strings.TrimSpace(helpText)
@@ -40,8 +47,13 @@ func (*NewCommand) Synopsis() string {
 }
 
 func (c *NewCommand) Run(args []string) int {
+	var sequential bool
+	var padding int
+
 	cmdFlags := flag.NewFlagSet("new", flag.ContinueOnError)
 	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	cmdFlags.BoolVar(&sequential, "sequential", false, "Number the migration after the existing ones.")
+	cmdFlags.IntVar(&padding, "padding", 0, "Zero pad sequential numbers to this width.")
 	ConfigFlags(cmdFlags)
 
 	if len(args) < 1 {
@@ -54,14 +66,14 @@ func (c *NewCommand) Run(args []string) int {
 		return 1
 	}
 
-	if err := CreateMigration(cmdFlags.Arg(0)); err != nil {
+	if err := CreateMigration(cmdFlags.Arg(0), sequential, padding); err != nil {
 		ui.Error(err.Error())
 		return 1
 	}
 	return 0
 }
 
-func CreateMigration(name string) error {
+func CreateMigration(name string, sequential bool, padding int) error {
 	env, err := GetEnvironment()
 	if err != nil {
 		return err
@@ -71,7 +83,23 @@ func CreateMigration(name string) error {
 		return err
 	}
 
-	fileName := fmt.Sprintf("%s-%s.sql", time.Now().Format("20060102150405"), strings.TrimSpace(name))
+	if padding == 0 {
+		padding = env.Padding
+	}
+
+	var fileName string
+	if sequential || env.Sequential {
+		source := GetMigrationSource(env)
+		migrations, err := source.FindMigrations()
+		if err != nil {
+			return err
+		}
+
+		prefix := nextSequenceNumber(migrations, padding)
+		fileName = fmt.Sprintf("%s_%s.sql", prefix, strings.TrimSpace(name))
+	} else {
+		fileName = fmt.Sprintf("%s-%s.sql", time.Now().Format("20060102150405"), strings.TrimSpace(name))
+	}
 	pathName := path.Join(env.Dir, fileName)
 	f, err := os.Create(pathName)
 	if err != nil {
@@ -86,3 +114,27 @@ func CreateMigration(name string) error {
 	ui.Output(fmt.Sprintf("Created migration %s", pathName))
 	return nil
 }
+
+// Returns the zero padded number that follows the highest numbered migration.
+//
+// When padding is 0, the width of the number of the last migration is used, or
+// 4 when there are no numbered migrations yet.
+func nextSequenceNumber(migrations []*migrate.Migration, padding int) string {
+	next := int64(1)
+	width := 4
+	for _, m := range migrations {
+		v, err := m.Version()
+		if err != nil {
+			continue
+		}
+		if v >= next {
+			next = v + 1
+			width = len(m.NumberPrefixMatches()[1])
+		}
+	}
+
+	if padding == 0 {
+		padding = width
+	}
+	return fmt.Sprintf("%0*d", padding, next)
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+type PlanCommand struct{}
+
+func (*PlanCommand) Help() string {
+	helpText := `
+Usage: sql-migrate plan [options] ...
+
+  Create a migration plan, to be executed later with the apply command.
+
+  The plan records the statements to run and the state of the migration
+  table. Applying it is refused when the database or the migrations changed
+  in the meantime.
+
+Options:
+
+  -config=dbconfig.yml   Configuration file to use.
+  -env="development"     Environment.
+  -dialect=""            Dialect, overrides the environment.
+  -dsn=""                Data source, overrides the environment.
+  -dir=""                Migrations directory, overrides the environment.
+  -down                  Plan to undo migrations instead of applying them.
+  -limit=0               Limit the number of migrations (0 = unlimited).
+  -out=plan.json         File to write the plan to (- = standard output).
+
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (*PlanCommand) Synopsis() string {
+	return "Create a migration plan to apply later"
+}
+
+func (c *PlanCommand) Run(args []string) int {
+	var down bool
+	var limit int
+	var out string
+
+	cmdFlags := flag.NewFlagSet("plan", flag.ContinueOnError)
+	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	cmdFlags.BoolVar(&down, "down", false, "Plan to undo migrations.")
+	cmdFlags.IntVar(&limit, "limit", 0, "Max number of migrations to plan.")
+	cmdFlags.StringVar(&out, "out", "plan.json", "File to write the plan to.")
+	ConfigFlags(cmdFlags)
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	dir := migrate.Up
+	if down {
+		dir = migrate.Down
+	}
+
+	err := CreatePlan(dir, limit, out)
+	if err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+func CreatePlan(dir migrate.MigrationDirection, limit int, out string) error {
+	env, err := GetEnvironment()
+	if err != nil {
+		return fmt.Errorf("Could not parse config: %w", err)
+	}
+
+	db, dialect, err := GetConnection(env)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	source := GetMigrationSource(env)
+
+	plan, err := GetMigrationSet(env).CreatePlan(db, dialect, source, dir, limit)
+	if err != nil {
+		return fmt.Errorf("Cannot plan migration: %w", err)
+	}
+
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if out == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+
+	if err := os.WriteFile(out, data, 0o644); err != nil {
+		return err
+	}
+
+	for _, step := range plan.Steps {
+		ui.Output(fmt.Sprintf("==> Will apply migration %s (%s)", step.Id, step.Direction))
+	}
+	if len(plan.Steps) == 1 {
+		ui.Output(fmt.Sprintf("Planned 1 migration in %s", out))
+	} else {
+		ui.Output(fmt.Sprintf("Planned %d migrations in %s", len(plan.Steps), out))
+	}
+
+	return nil
+}
@@ -20,7 +20,13 @@ Options:
 
   -config=dbconfig.yml   Configuration file to use.
   -env="development"     Environment.
+  -dialect=""            Dialect, overrides the environment.
+  -dsn=""                Data source, overrides the environment.
+  -dir=""                Migrations directory, overrides the environment.
   -dryrun                Don't apply migrations, just print them.
+  -output=text           Output format: text, json or yaml. With json or yaml,
+                         exits with 2 when the migration was (or would be) reapplied.
+  -yes                   Don't ask for confirmation in environments that require it.
 
 `
 	return strings.TrimSpace(helpText)
@@ -37,55 +43,76 @@ func (c *RedoCommand) Run(args []string) int {
 	cmdFlags.Usage = func() { ui.Output(c.Help()) }
 	cmdFlags.BoolVar(&dryrun, "dryrun", false, "Don't apply migrations, just print them.")
 	ConfigFlags(cmdFlags)
+	OutputFlags(cmdFlags)
+	PolicyFlags(cmdFlags)
 
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
 	}
 
+	return reportRun(RedoMigration(dryrun))
+}
+
+func RedoMigration(dryrun bool) (*runOutput, error) {
+	output := newRunOutput("redo", dryrun)
+
 	env, err := GetEnvironment()
 	if err != nil {
-		ui.Error(fmt.Sprintf("Could not parse config: %s", err))
-		return 1
+		return output, fmt.Errorf("Could not parse config: %w", err)
 	}
 
 	db, dialect, err := GetConnection(env)
 	if err != nil {
-		ui.Error(err.Error())
-		return 1
+		return output, err
 	}
 	defer db.Close()
 
-	source := migrate.FileMigrationSource{
-		Dir: env.Dir,
-	}
+	source := GetMigrationSource(env)
+	ms := output.migrationSet(env)
 
-	migrations, _, err := migrate.PlanMigration(db, dialect, source, migrate.Down, 1)
+	migrations, dbMap, err := ms.PlanMigration(db, dialect, source, migrate.Down, 1)
 	if err != nil {
-		ui.Error(fmt.Sprintf("Migration (redo) failed: %v", err))
-		return 1
+		return output, fmt.Errorf("Migration (redo) failed: %w", err)
 	} else if len(migrations) == 0 {
-		ui.Output("Nothing to do!")
-		return 0
+		if !OutputFormat.structured() {
+			ui.Output("Nothing to do!")
+		}
+		return output, nil
+	}
+
+	if err := checkPolicy(env, migrate.Down, len(migrations), dryrun); err != nil {
+		return output, err
 	}
 
 	if dryrun {
-		PrintMigration(migrations[0], migrate.Down)
-		PrintMigration(migrations[0], migrate.Up)
+		if err := output.addPlanned(migrations[0], migrate.Down); err != nil {
+			return output, err
+		}
+		if err := output.addPlanned(migrations[0], migrate.Up); err != nil {
+			return output, err
+		}
 	} else {
-		_, err := migrate.ExecMax(db, dialect, source, migrate.Down, 1)
+		// The same migration is reverted and applied again, without
+		// planning again.
+		_, err := ms.ExecPlanned(dbMap, migrate.Down, migrations)
 		if err != nil {
-			ui.Error(fmt.Sprintf("Migration (down) failed: %s", err))
-			return 1
+			return output, migrationFailed(source, "Migration (down) failed", err)
 		}
 
-		_, err = migrate.ExecMax(db, dialect, source, migrate.Up, 1)
+		redo := &migrate.PlannedMigration{
+			Migration:          migrations[0].Migration,
+			Queries:            migrations[0].Up,
+			DisableTransaction: migrations[0].DisableTransactionUp,
+		}
+		_, err = ms.ExecPlanned(dbMap, migrate.Up, []*migrate.PlannedMigration{redo})
 		if err != nil {
-			ui.Error(fmt.Sprintf("Migration (up) failed: %s", err))
-			return 1
+			return output, migrationFailed(source, "Migration (up) failed", err)
 		}
 
-		ui.Output(fmt.Sprintf("Reapplied migration %s.", migrations[0].Id))
+		if !OutputFormat.structured() {
+			ui.Output(fmt.Sprintf("Reapplied migration %s.", migrations[0].Id))
+		}
 	}
 
-	return 0
+	return output, nil
 }
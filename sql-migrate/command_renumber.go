@@ -0,0 +1,252 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+type RenumberCommand struct{}
+
+func (*RenumberCommand) Help() string {
+	helpText := `
+Usage: sql-migrate renumber [options] ...
+
+  Renumber the migrations that haven't been applied yet, to close gaps in the
+  numbering or resolve duplicate numbers, for example after merging branches.
+
+  Applied migrations keep their number, unless -history is given. Their
+  records are then renamed as well, which is only done when none of the new
+  ids have been applied. Other databases that applied them will see them as
+  unknown migrations, so only use it when there is a single database.
+
+Options:
+
+  -config=dbconfig.yml   Configuration file to use.
+  -env="development"     Environment.
+  -dialect=""            Dialect, overrides the environment.
+  -dsn=""                Data source, overrides the environment.
+  -dir=""                Migrations directory, overrides the environment.
+  -padding=0             Zero pad the numbers to this width (0 = keep the current width).
+  -history               Also renumber applied migrations and rename their records.
+  -dryrun                Don't rename anything, just print the new names.
+
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (*RenumberCommand) Synopsis() string {
+	return "Renumber migrations to close gaps and resolve duplicates"
+}
+
+func (c *RenumberCommand) Run(args []string) int {
+	var padding int
+	var history bool
+	var dryrun bool
+
+	cmdFlags := flag.NewFlagSet("renumber", flag.ContinueOnError)
+	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	cmdFlags.IntVar(&padding, "padding", 0, "Zero pad the numbers to this width.")
+	cmdFlags.BoolVar(&history, "history", false, "Also renumber applied migrations.")
+	cmdFlags.BoolVar(&dryrun, "dryrun", false, "Don't rename anything, just print the new names.")
+	ConfigFlags(cmdFlags)
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	err := RenumberMigrations(padding, history, dryrun)
+	if err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+func RenumberMigrations(padding int, history bool, dryrun bool) error {
+	env, err := GetEnvironment()
+	if err != nil {
+		return fmt.Errorf("Could not parse config: %w", err)
+	}
+
+	db, dialect, err := GetConnection(env)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	source := GetMigrationSource(env)
+	migrations, err := source.FindMigrations()
+	if err != nil {
+		return err
+	}
+	files, err := source.FindMigrationFiles()
+	if err != nil {
+		return err
+	}
+
+	records, err := migrate.GetMigrationRecords(db, dialect)
+	if err != nil {
+		return err
+	}
+	applied := make(map[string]bool)
+	for _, r := range records {
+		applied[r.Id] = true
+	}
+
+	renames, err := planRenumber(migrations, applied, history, padding)
+	if err != nil {
+		return err
+	}
+	if len(renames) == 0 {
+		ui.Output("Nothing to do!")
+		return nil
+	}
+
+	for _, r := range renames {
+		ui.Output(fmt.Sprintf("%s -> %s", r.From, r.To))
+	}
+	if dryrun {
+		return nil
+	}
+
+	// Rename the files first, they're renamed back when the records can't
+	// be renamed. The records are renamed in a single transaction.
+	undo, err := renameMigrationFiles(env.Dir, files, renames)
+	if err != nil {
+		return err
+	}
+
+	recordRenames := make(map[string]string)
+	for _, r := range renames {
+		if r.Applied {
+			recordRenames[r.From] = r.To
+		}
+	}
+	if len(recordRenames) > 0 {
+		if err := migrate.RenameMigrationRecords(db, dialect, recordRenames); err != nil {
+			if undoErr := undo(); undoErr != nil {
+				return fmt.Errorf("%w (renaming the files back failed: %w)", err, undoErr)
+			}
+			return err
+		}
+	}
+
+	if len(renames) == 1 {
+		ui.Output("Renumbered 1 migration")
+	} else {
+		ui.Output(fmt.Sprintf("Renumbered %d migrations", len(renames)))
+	}
+	return nil
+}
+
+type renumbering struct {
+	From    string
+	To      string
+	Applied bool
+}
+
+// Numbers the migrations sequentially, keeping their order. Applied migrations
+// keep their number unless renumberApplied is set, in which case the other
+// migrations have to fit around them.
+func planRenumber(migrations []*migrate.Migration, applied map[string]bool, renumberApplied bool, padding int) ([]renumbering, error) {
+	var renames []renumbering
+
+	next := int64(1)
+	last := ""
+	for _, m := range migrations {
+		v, err := m.Version()
+		if err != nil {
+			continue
+		}
+
+		if applied[m.Id] && !renumberApplied {
+			if v < next {
+				return nil, fmt.Errorf("Cannot renumber %s without renumbering applied migration %s, use -history to do so", last, m.Id)
+			}
+			next = v + 1
+			last = m.Id
+			continue
+		}
+
+		prefix := m.NumberPrefixMatches()[1]
+		width := padding
+		if width == 0 {
+			width = len(prefix)
+		}
+		fileName := fmt.Sprintf("%0*d", width, next) + strings.TrimPrefix(path.Base(m.Id), prefix)
+		id := path.Join(path.Dir(m.Id), fileName)
+		if id != m.Id {
+			renames = append(renames, renumbering{
+				From:    m.Id,
+				To:      id,
+				Applied: applied[m.Id],
+			})
+		}
+		next++
+		last = m.Id
+	}
+
+	return renames, nil
+}
+
+// Renames the files in two steps, so one migration can take the name another
+// migration is being renamed from. Files stay in their directory.
+//
+// When a rename fails, the files that were already renamed are renamed back.
+// The returned undo function does the same after all files were renamed.
+func renameMigrationFiles(dir string, files map[string]string, renames []renumbering) (undo func() error, err error) {
+	from := make([]string, len(renames))
+	to := make([]string, len(renames))
+	tmp := make([]string, len(renames))
+	for i, r := range renames {
+		from[i] = path.Join(dir, files[r.From])
+		to[i] = path.Join(path.Dir(from[i]), path.Base(r.To))
+		tmp[i] = path.Join(dir, fmt.Sprintf(".renumber-%d", i))
+	}
+
+	for i, r := range renames {
+		if _, err := os.Stat(to[i]); err == nil && !slices.Contains(from, to[i]) {
+			return nil, fmt.Errorf("Cannot rename %s to %s: file already exists", r.From, r.To)
+		}
+	}
+
+	// The renames done so far, as from and to pairs.
+	var done [][2]string
+	undo = func() error {
+		var errs []error
+		for i := len(done) - 1; i >= 0; i-- {
+			if err := os.Rename(done[i][1], done[i][0]); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		done = nil
+		return errors.Join(errs...)
+	}
+	rename := func(from, to string) error {
+		if err := os.Rename(from, to); err != nil {
+			return errors.Join(err, undo())
+		}
+		done = append(done, [2]string{from, to})
+		return nil
+	}
+
+	for i := range renames {
+		if err := rename(from[i], tmp[i]); err != nil {
+			return nil, err
+		}
+	}
+	for i := range renames {
+		if err := rename(tmp[i], to[i]); err != nil {
+			return nil, err
+		}
+	}
+	return undo, nil
+}
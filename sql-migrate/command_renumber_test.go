@@ -0,0 +1,123 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+type RenumberSuite struct{}
+
+var _ = Suite(&RenumberSuite{})
+
+func (*RenumberSuite) TestCloseGaps(c *C) {
+	migrations := []*migrate.Migration{
+		{Id: "0001_a.sql"},
+		{Id: "0003_b.sql"},
+		{Id: "0007_c.sql"},
+		{Id: "other.sql"},
+	}
+
+	renames, err := planRenumber(migrations, map[string]bool{"0001_a.sql": true}, false, 0)
+	c.Assert(err, IsNil)
+	c.Assert(renames, DeepEquals, []renumbering{
+		{From: "0003_b.sql", To: "0002_b.sql"},
+		{From: "0007_c.sql", To: "0003_c.sql"},
+	})
+}
+
+func (*RenumberSuite) TestResolveCollisions(c *C) {
+	migrations := []*migrate.Migration{
+		{Id: "1_a.sql"},
+		{Id: "2_b.sql"},
+		{Id: "2_c.sql"},
+		{Id: "3_d.sql"},
+	}
+
+	renames, err := planRenumber(migrations, map[string]bool{"1_a.sql": true, "2_b.sql": true}, false, 3)
+	c.Assert(err, IsNil)
+	c.Assert(renames, DeepEquals, []renumbering{
+		{From: "2_c.sql", To: "003_c.sql"},
+		{From: "3_d.sql", To: "004_d.sql"},
+	})
+}
+
+func (*RenumberSuite) TestAppliedInTheWay(c *C) {
+	migrations := []*migrate.Migration{
+		{Id: "1_a.sql"},
+		{Id: "1_b.sql"},
+		{Id: "2_c.sql"},
+	}
+	applied := map[string]bool{"2_c.sql": true}
+
+	_, err := planRenumber(migrations, applied, false, 0)
+	c.Assert(err, NotNil)
+
+	renames, err := planRenumber(migrations, applied, true, 0)
+	c.Assert(err, IsNil)
+	c.Assert(renames, DeepEquals, []renumbering{
+		{From: "1_b.sql", To: "2_b.sql"},
+		{From: "2_c.sql", To: "3_c.sql", Applied: true},
+	})
+}
+
+func (*RenumberSuite) TestSubdirectories(c *C) {
+	migrations := []*migrate.Migration{
+		{Id: "1_a.sql"},
+		{Id: "2024/3_b.sql"},
+	}
+
+	renames, err := planRenumber(migrations, nil, false, 0)
+	c.Assert(err, IsNil)
+	c.Assert(renames, DeepEquals, []renumbering{
+		{From: "2024/3_b.sql", To: "2024/2_b.sql"},
+	})
+}
+
+func (*RenumberSuite) TestNextSequenceNumber(c *C) {
+	c.Assert(nextSequenceNumber(nil, 0), Equals, "0001")
+	c.Assert(nextSequenceNumber([]*migrate.Migration{{Id: "001_a.sql"}, {Id: "009_b.sql"}}, 0), Equals, "010")
+	c.Assert(nextSequenceNumber([]*migrate.Migration{{Id: "1_a.sql"}, {Id: "other.sql"}}, 5), Equals, "00002")
+}
+
+func (*RenumberSuite) TestRenameFilesBack(c *C) {
+	dir := c.MkDir()
+	for _, name := range []string{"1_a.sql", "3_b.sql", "5_c.sql"} {
+		c.Assert(os.WriteFile(filepath.Join(dir, name), []byte(name), 0o600), IsNil)
+	}
+	files := map[string]string{"3_b.sql": "3_b.sql", "5_c.sql": "5_c.sql", "7_d.sql": "7_d.sql"}
+	names := func() []string {
+		entries, err := os.ReadDir(dir)
+		c.Assert(err, IsNil)
+		var names []string
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+		return names
+	}
+
+	undo, err := renameMigrationFiles(dir, files, []renumbering{
+		{From: "3_b.sql", To: "2_b.sql"},
+		{From: "5_c.sql", To: "3_c.sql"},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(names(), DeepEquals, []string{"1_a.sql", "2_b.sql", "3_c.sql"})
+	content, err := os.ReadFile(filepath.Join(dir, "3_c.sql"))
+	c.Assert(err, IsNil)
+	c.Assert(string(content), Equals, "5_c.sql")
+
+	c.Assert(undo(), IsNil)
+	c.Assert(names(), DeepEquals, []string{"1_a.sql", "3_b.sql", "5_c.sql"})
+
+	// A failed rename puts back the files renamed before it.
+	_, err = renameMigrationFiles(dir, files, []renumbering{
+		{From: "3_b.sql", To: "2_b.sql"},
+		{From: "7_d.sql", To: "3_d.sql"},
+	})
+	c.Assert(err, NotNil)
+	c.Assert(names(), DeepEquals, []string{"1_a.sql", "3_b.sql", "5_c.sql"})
+}
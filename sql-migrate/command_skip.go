@@ -20,7 +20,13 @@ Options:
 
   -config=dbconfig.yml   Configuration file to use.
   -env="development"     Environment.
+  -dialect=""            Dialect, overrides the environment.
+  -dsn=""                Data source, overrides the environment.
+  -dir=""                Migrations directory, overrides the environment.
   -limit=0               Limit the number of migrations (0 = unlimited).
+  -output=text           Output format: text, json or yaml. With json or yaml,
+                         exits with 2 when migrations were skipped.
+  -yes                   Don't ask for confirmation in environments that require it.
 
 `
 	return strings.TrimSpace(helpText)
@@ -37,39 +43,56 @@ func (c *SkipCommand) Run(args []string) int {
 	cmdFlags.Usage = func() { ui.Output(c.Help()) }
 	cmdFlags.IntVar(&limit, "limit", 0, "Max number of migrations to skip.")
 	ConfigFlags(cmdFlags)
+	OutputFlags(cmdFlags)
+	PolicyFlags(cmdFlags)
 
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
 	}
 
-	err := SkipMigrations(migrate.Up, limit)
-	if err != nil {
-		ui.Error(err.Error())
-		return 1
-	}
-
-	return 0
+	return reportRun(SkipMigrations(migrate.Up, limit))
 }
 
-func SkipMigrations(dir migrate.MigrationDirection, limit int) error {
+func SkipMigrations(dir migrate.MigrationDirection, limit int) (*runOutput, error) {
+	output := newRunOutput("skip", false)
+
 	env, err := GetEnvironment()
 	if err != nil {
-		return fmt.Errorf("Could not parse config: %w", err)
+		return output, fmt.Errorf("Could not parse config: %w", err)
 	}
 
 	db, dialect, err := GetConnection(env)
 	if err != nil {
-		return err
+		return output, err
 	}
 	defer db.Close()
 
-	source := migrate.FileMigrationSource{
-		Dir: env.Dir,
+	source := GetMigrationSource(env)
+
+	migrations, _, err := migrate.PlanMigration(db, dialect, source, dir, limit)
+	if err != nil {
+		return output, fmt.Errorf("Migration failed: %w", err)
+	}
+
+	if err := checkPolicy(env, dir, len(migrations), false); err != nil {
+		return output, err
 	}
 
 	n, err := migrate.SkipMax(db, dialect, source, dir, limit)
 	if err != nil {
-		return fmt.Errorf("Migration failed: %w", err)
+		return output, fmt.Errorf("Migration failed: %w", err)
+	}
+
+	for _, m := range migrations[:min(n, len(migrations))] {
+		output.Migrations = append(output.Migrations, &migrationOutput{
+			Id:        m.Id,
+			Direction: dir.String(),
+			Status:    statusSkipped,
+		})
+	}
+
+	if OutputFormat.structured() {
+		return output, nil
 	}
 
 	switch n {
@@ -81,5 +104,5 @@ func SkipMigrations(dir migrate.MigrationDirection, limit int) error {
 		ui.Output(fmt.Sprintf("Skipped %d migrations", n))
 	}
 
-	return nil
+	return output, nil
 }
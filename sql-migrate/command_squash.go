@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+type SquashCommand struct{}
+
+func (*SquashCommand) Help() string {
+	helpText := `
+Usage: sql-migrate squash [options] ...
+
+  Squash the migrations up to and including a migration into a single new
+  migration, containing all of their Up statements.
+
+  The squashed migrations are moved to an archive directory. Databases that
+  applied all of them are treated as having applied the new migration.
+
+Options:
+
+  -config=dbconfig.yml   Configuration file to use.
+  -env="development"     Environment.
+  -dialect=""            Dialect, overrides the environment.
+  -dsn=""                Data source, overrides the environment.
+  -dir=""                Migrations directory, overrides the environment.
+  -through               Id of the last migration to squash, eg: 42_add_index.sql.
+  -name=squashed         Name of the new migration, its number is the one of the last squashed migration.
+  -archive               Directory to move the squashed migrations to (defaults to _archive in the migrations directory).
+  -dryrun                Don't write or move anything, just print the new migration.
+
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (*SquashCommand) Synopsis() string {
+	return "Squash old migrations into a single migration"
+}
+
+func (c *SquashCommand) Run(args []string) int {
+	var through string
+	var name string
+	var archive string
+	var dryrun bool
+
+	cmdFlags := flag.NewFlagSet("squash", flag.ContinueOnError)
+	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	cmdFlags.StringVar(&through, "through", "", "Id of the last migration to squash.")
+	cmdFlags.StringVar(&name, "name", "squashed", "Name of the new migration.")
+	cmdFlags.StringVar(&archive, "archive", "", "Directory to move the squashed migrations to.")
+	cmdFlags.BoolVar(&dryrun, "dryrun", false, "Don't write or move anything, just print the new migration.")
+	ConfigFlags(cmdFlags)
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	if through == "" {
+		ui.Error(errors.New("The last migration to squash is needed, use -through").Error())
+		return 1
+	}
+
+	err := SquashMigrations(through, name, archive, dryrun)
+	if err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+
+	return 0
+}
+
+func SquashMigrations(through, name, archive string, dryrun bool) error {
+	env, err := GetEnvironment()
+	if err != nil {
+		return fmt.Errorf("Could not parse config: %w", err)
+	}
+
+	if archive == "" {
+		archive = path.Join(env.Dir, "_archive")
+	}
+
+	// The squashed migration holds all statements, streaming doesn't help.
+	source := GetMigrationSource(env)
+	source.StreamLargerThan = 0
+	migrations, err := source.FindMigrations()
+	if err != nil {
+		return err
+	}
+	files, err := source.FindMigrationFiles()
+	if err != nil {
+		return err
+	}
+
+	var squashed []*migrate.Migration
+	for _, m := range migrations {
+		squashed = append(squashed, m)
+		if m.Id == through {
+			break
+		}
+	}
+	if len(squashed) == 0 || squashed[len(squashed)-1].Id != through {
+		return fmt.Errorf("Unknown migration: %s", through)
+	}
+
+	// The new migration takes the place of the last squashed one, in the
+	// same directory.
+	prefix := squashed[len(squashed)-1].NumberPrefixMatches()
+	if len(prefix) == 0 {
+		return fmt.Errorf("Cannot squash through %s: it has no number", through)
+	}
+	fileName := fmt.Sprintf("%s_%s.sql", prefix[1], strings.TrimSpace(name))
+	id := path.Join(path.Dir(through), fileName)
+	for _, m := range migrations {
+		if m.Id == id {
+			return fmt.Errorf("Cannot squash into %s: migration already exists", id)
+		}
+	}
+
+	content, disableTransaction := squashedMigration(squashed)
+	if disableTransaction {
+		ui.Warn("Some squashed migrations run without a transaction, so the squashed migration does too")
+	}
+
+	if dryrun {
+		ui.Output(fmt.Sprintf("==> Would create migration %s", id))
+		ui.Output(string(content))
+		return nil
+	}
+
+	pathName := path.Join(env.Dir, path.Dir(files[through]), fileName)
+	if err := os.WriteFile(pathName, content, 0o644); err != nil {
+		return err
+	}
+
+	for _, m := range squashed {
+		archived := path.Join(archive, files[m.Id])
+		if err := os.MkdirAll(path.Dir(archived), 0o755); err != nil {
+			return err
+		}
+		if err := os.Rename(path.Join(env.Dir, files[m.Id]), archived); err != nil {
+			return err
+		}
+	}
+
+	ui.Output(fmt.Sprintf("Squashed %d migrations into %s", len(squashed), pathName))
+	return nil
+}
+
+// Returns the contents of a migration file that replaces the given migrations,
+// and whether it has to run without a transaction.
+func squashedMigration(migrations []*migrate.Migration) ([]byte, bool) {
+	var buf bytes.Buffer
+	disableTransaction := false
+
+	for _, m := range migrations {
+		// Migrations that were squashed before stay replaced.
+		for _, id := range m.Squashes {
+			fmt.Fprintf(&buf, "-- +migrate Squashes %s\n", id)
+		}
+		fmt.Fprintf(&buf, "-- +migrate Squashes %s\n", m.Id)
+		disableTransaction = disableTransaction || m.DisableTransactionUp
+	}
+
+	if disableTransaction {
+		buf.WriteString("\n-- +migrate Up notransaction\n")
+	} else {
+		buf.WriteString("\n-- +migrate Up\n")
+	}
+	// Blank lines would end up in the statements.
+	for _, m := range migrations {
+		fmt.Fprintf(&buf, "-- From %s\n", m.Id)
+		for i, stmt := range m.Up {
+			// PL/SQL blocks need their final semicolon, which only stays
+			// when they're ended by the / separator.
+			if i < len(m.UpBlocks) && m.UpBlocks[i] {
+				buf.WriteString(strings.TrimRight(stmt, "\n"))
+				buf.WriteString("\n/\n")
+				continue
+			}
+			buf.WriteString("-- +migrate StatementBegin\n")
+			buf.WriteString(strings.TrimRight(stmt, "\n"))
+			buf.WriteString("\n-- +migrate StatementEnd\n")
+		}
+	}
+
+	buf.WriteString("-- +migrate Down irreversible\n")
+	buf.WriteString("-- The squashed migrations can't be undone as a whole.\n")
+
+	return buf.Bytes(), disableTransaction
+}
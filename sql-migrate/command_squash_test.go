@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+
+	migrate "github.com/rubenv/sql-migrate"
+	"github.com/rubenv/sql-migrate/sqlparse"
+)
+
+type SquashSuite struct{}
+
+var _ = Suite(&SquashSuite{})
+
+func (*SquashSuite) TestSquashedMigration(c *C) {
+	migrations := []*migrate.Migration{
+		{
+			Id:       "2_squashed.sql",
+			Up:       []string{"CREATE TABLE people (id int);\n"},
+			Squashes: []string{"1_create.sql", "2_alter.sql"},
+		},
+		{
+			Id:                   "3_function.sql",
+			Up:                   []string{"CREATE FUNCTION f() AS $$\nSELECT 1;\n$$;\n", "SELECT 2;\n"},
+			DisableTransactionUp: true,
+		},
+	}
+
+	content, disableTransaction := squashedMigration(migrations)
+	c.Assert(disableTransaction, Equals, true)
+
+	m, err := migrate.ParseMigration("3_squashed.sql", bytes.NewReader(content))
+	c.Assert(err, IsNil)
+	c.Assert(m.Squashes, DeepEquals, []string{"1_create.sql", "2_alter.sql", "2_squashed.sql", "3_function.sql"})
+	c.Assert(m.Up, DeepEquals, []string{
+		"CREATE TABLE people (id int);\n",
+		"CREATE FUNCTION f() AS $$\nSELECT 1;\n$$;\n",
+		"SELECT 2;\n",
+	})
+	c.Assert(m.Down, HasLen, 0)
+	c.Assert(m.Irreversible, Equals, true)
+	c.Assert(m.DisableTransactionUp, Equals, true)
+}
+
+func (*SquashSuite) TestSquashedBlocks(c *C) {
+	migrations := []*migrate.Migration{
+		{
+			Id:       "1_people.sql",
+			Up:       []string{"CREATE OR REPLACE PROCEDURE add_person(p_id NUMBER) AS\nBEGIN\n  INSERT INTO people VALUES (p_id);\nEND;\n", "CREATE TABLE people (id NUMBER);\n"},
+			UpBlocks: []bool{true, false},
+		},
+		{
+			Id:       "2_call.sql",
+			Up:       []string{"BEGIN\n  add_person(1);\nEND;\n"},
+			UpBlocks: []bool{true},
+		},
+	}
+
+	content, _ := squashedMigration(migrations)
+
+	m, err := migrate.ParseMigrationWithOptions("2_squashed.sql", bytes.NewReader(content), sqlparse.ParseOptions{Separator: "/"})
+	c.Assert(err, IsNil)
+	c.Assert(m.Up, DeepEquals, []string{
+		"CREATE OR REPLACE PROCEDURE add_person(p_id NUMBER) AS\nBEGIN\n  INSERT INTO people VALUES (p_id);\nEND;\n",
+		"CREATE TABLE people (id NUMBER);\n",
+		"BEGIN\n  add_person(1);\nEND;\n",
+	})
+	c.Assert(m.UpBlocks, DeepEquals, []bool{true, false, true})
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"os"
@@ -20,10 +21,19 @@ Usage: sql-migrate status [options] ...
 
   Show migration status.
 
+  Migrations that were changed after they were applied are marked as such,
+  as are pending migrations that sort before an applied one.
+
 Options:
 
   -config=dbconfig.yml   Configuration file to use.
   -env="development"     Environment.
+  -dialect=""            Dialect, overrides the environment.
+  -dsn=""                Data source, overrides the environment.
+  -dir=""                Migrations directory, overrides the environment.
+  -check                 Exit with status 1 when migrations are pending, unknown,
+                         out of order or changed since they were applied.
+  -output=text           Output format: text, json or yaml.
 
 `
 	return strings.TrimSpace(helpText)
@@ -34,9 +44,13 @@ func (*StatusCommand) Synopsis() string {
 }
 
 func (c *StatusCommand) Run(args []string) int {
+	var check bool
+
 	cmdFlags := flag.NewFlagSet("status", flag.ContinueOnError)
 	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	cmdFlags.BoolVar(&check, "check", false, "Exit with status 1 when migrations are pending or inconsistent.")
 	ConfigFlags(cmdFlags)
+	OutputFlags(cmdFlags)
 
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
@@ -55,65 +69,108 @@ func (c *StatusCommand) Run(args []string) int {
 	}
 	defer db.Close()
 
-	source := migrate.FileMigrationSource{
-		Dir: env.Dir,
+	report, err := GetMigrationSet(env).Status(context.Background(), db, dialect, GetMigrationSource(env))
+	if err == nil && check {
+		err = report.Check()
 	}
-	migrations, err := source.FindMigrations()
-	if err != nil {
-		ui.Error(err.Error())
-		return 1
+
+	if OutputFormat.structured() {
+		output := statusOutput{Migrations: []statusMigrationOutput{}}
+		if report != nil {
+			output = newStatusOutput(report)
+		}
+		if err != nil {
+			output.Error = newErrorOutput(err)
+		}
+		if err := writeOutput(output); err != nil {
+			ui.Error(err.Error())
+			return 1
+		}
+	} else {
+		if report != nil {
+			printStatus(report)
+		}
+		if err != nil {
+			ui.Error(err.Error())
+		}
 	}
 
-	records, err := migrate.GetMigrationRecords(db, dialect)
 	if err != nil {
-		ui.Error(err.Error())
 		return 1
 	}
+	return 0
+}
+
+func printStatus(report *migrate.StatusReport) {
+	for _, m := range report.Migrations {
+		if m.Unknown {
+			ui.Warn(fmt.Sprintf("Could not find migration file: %v", m.Id))
+		}
+	}
 
 	table := tablewriter.NewWriter(os.Stdout)
 	table.SetHeader([]string{"Migration", "Applied"})
 	table.SetColWidth(60)
 
-	rows := make(map[string]*statusRow)
-
-	for _, m := range migrations {
-		rows[m.Id] = &statusRow{
-			Id:       m.Id,
-			Migrated: false,
-		}
-	}
-
-	for _, r := range records {
-		if rows[r.Id] == nil {
-			ui.Warn(fmt.Sprintf("Could not find migration file: %v", r.Id))
+	for _, m := range report.Migrations {
+		var applied string
+		switch {
+		case m.Unknown:
 			continue
+		case m.Drifted:
+			applied = m.AppliedAt.String() + " (changed since)"
+		case m.Applied:
+			applied = m.AppliedAt.String()
+		case m.OutOfOrder:
+			applied = "no (out of order)"
+		default:
+			applied = "no"
 		}
-
-		rows[r.Id].Migrated = true
-		rows[r.Id].AppliedAt = r.AppliedAt
-	}
-
-	for _, m := range migrations {
-		if rows[m.Id] != nil && rows[m.Id].Migrated {
-			table.Append([]string{
-				m.Id,
-				rows[m.Id].AppliedAt.String(),
-			})
-		} else {
-			table.Append([]string{
-				m.Id,
-				"no",
-			})
-		}
+		table.Append([]string{m.Id, applied})
 	}
 
 	table.Render()
+}
 
-	return 0
+// The document written by the status command with -output json or yaml.
+type statusOutput struct {
+	Migrations []statusMigrationOutput `json:"migrations" yaml:"migrations"`
+
+	// Error is why the status couldn't be read, or with -check, why the
+	// check failed.
+	Error *errorOutput `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+type statusMigrationOutput struct {
+	Id            string     `json:"id" yaml:"id"`
+	Applied       bool       `json:"applied" yaml:"applied"`
+	AppliedAt     *time.Time `json:"applied_at,omitempty" yaml:"applied_at,omitempty"`
+	Unknown       bool       `json:"unknown" yaml:"unknown"`
+	OutOfOrder    bool       `json:"out_of_order" yaml:"out_of_order"`
+	Drifted       bool       `json:"drifted" yaml:"drifted"`
+	NoTransaction bool       `json:"no_transaction" yaml:"no_transaction"`
+	HasDown       bool       `json:"has_down" yaml:"has_down"`
 }
 
-type statusRow struct {
-	Id        string
-	Migrated  bool
-	AppliedAt time.Time
+func newStatusOutput(report *migrate.StatusReport) statusOutput {
+	output := statusOutput{
+		Migrations: make([]statusMigrationOutput, 0, len(report.Migrations)),
+	}
+	for _, m := range report.Migrations {
+		migration := statusMigrationOutput{
+			Id:            m.Id,
+			Applied:       m.Applied,
+			Unknown:       m.Unknown,
+			OutOfOrder:    m.OutOfOrder,
+			Drifted:       m.Drifted,
+			NoTransaction: m.NoTransaction,
+			HasDown:       m.HasDown,
+		}
+		if m.Applied {
+			appliedAt := m.AppliedAt
+			migration.AppliedAt = &appliedAt
+		}
+		output.Migrations = append(output.Migrations, migration)
+	}
+	return output
 }
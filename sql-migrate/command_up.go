@@ -19,9 +19,15 @@ Options:
 
   -config=dbconfig.yml   Configuration file to use.
   -env="development"     Environment.
+  -dialect=""            Dialect, overrides the environment.
+  -dsn=""                Data source, overrides the environment.
+  -dir=""                Migrations directory, overrides the environment.
   -limit=0               Limit the number of migrations (0 = unlimited).
   -version               Run migrate up to a specific version, eg: the version number of migration 1_initial.sql is 1.
   -dryrun                Don't apply migrations, just print them.
+  -output=text           Output format: text, json or yaml. With json or yaml,
+                         exits with 2 when migrations were (or would be) applied.
+  -yes                   Don't ask for confirmation in environments that require it.
 
 `
 	return strings.TrimSpace(helpText)
@@ -42,16 +48,12 @@ func (c *UpCommand) Run(args []string) int {
 	cmdFlags.Int64Var(&version, "version", -1, "Migrate up to a specific version.")
 	cmdFlags.BoolVar(&dryrun, "dryrun", false, "Don't apply migrations, just print them.")
 	ConfigFlags(cmdFlags)
+	OutputFlags(cmdFlags)
+	PolicyFlags(cmdFlags)
 
 	if err := cmdFlags.Parse(args); err != nil {
 		return 1
 	}
 
-	err := ApplyMigrations(migrate.Up, dryrun, limit, version)
-	if err != nil {
-		ui.Error(err.Error())
-		return 1
-	}
-
-	return 0
+	return reportRun(ApplyMigrations(migrate.Up, dryrun, limit, version))
 }
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+type ValidateCommand struct{}
+
+func (*ValidateCommand) Help() string {
+	helpText := `
+Usage: sql-migrate validate [options] ...
+
+  Check the migrations directory without connecting to the database.
+
+  Reports migrations that don't parse, unknown or misspelled annotations,
+  migrations without Up statements, migrations sharing a version number,
+  version numbers that sort differently as text, and files that look like
+  migrations but don't end in .sql.
+
+  Exits with status 1 when problems were found.
+
+Options:
+
+  -config=dbconfig.yml   Configuration file to use.
+  -env="development"     Environment.
+  -dialect=""            Dialect, overrides the environment.
+  -dsn=""                Data source, overrides the environment.
+  -dir=""                Migrations directory, overrides the environment.
+  -output=text           Output format: text, json or yaml.
+
+`
+	return strings.TrimSpace(helpText)
+}
+
+func (*ValidateCommand) Synopsis() string {
+	return "Check the migrations directory for mistakes"
+}
+
+func (c *ValidateCommand) Run(args []string) int {
+	cmdFlags := flag.NewFlagSet("validate", flag.ContinueOnError)
+	cmdFlags.Usage = func() { ui.Output(c.Help()) }
+	ConfigFlags(cmdFlags)
+	OutputFlags(cmdFlags)
+
+	if err := cmdFlags.Parse(args); err != nil {
+		return 1
+	}
+
+	report, err := ValidateMigrations()
+	if err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+
+	if err := printValidationReport(report); err != nil {
+		ui.Error(err.Error())
+		return 1
+	}
+
+	if !report.Valid() {
+		return 1
+	}
+	return 0
+}
+
+func ValidateMigrations() (*migrate.ValidationReport, error) {
+	env, err := GetEnvironment()
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse config: %w", err)
+	}
+
+	return GetMigrationSource(env).Validate()
+}
+
+func printValidationReport(report *migrate.ValidationReport) error {
+	if OutputFormat.structured() {
+		return writeOutput(report)
+	}
+
+	for _, p := range report.Problems {
+		ui.Output(p.String())
+	}
+	switch {
+	case report.Valid() && report.Migrations == 1:
+		ui.Output("Found 1 valid migration")
+	case report.Valid():
+		ui.Output(fmt.Sprintf("Found %d valid migrations", report.Migrations))
+	case len(report.Problems) == 1:
+		ui.Output("Found 1 problem")
+	default:
+		ui.Output(fmt.Sprintf("Found %d problems", len(report.Problems)))
+	}
+	return nil
+}
@@ -5,17 +5,24 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io/fs"
 	"os"
+	"reflect"
+	"regexp"
 	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/go-gorp/gorp/v3"
 	"gopkg.in/yaml.v2"
 
 	migrate "github.com/rubenv/sql-migrate"
+	"github.com/rubenv/sql-migrate/sqlparse"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
 	_ "github.com/lib/pq"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
 var dialects = map[string]gorp.Dialect{
@@ -24,64 +31,327 @@ var dialects = map[string]gorp.Dialect{
 	"mysql":    gorp.MySQLDialect{Engine: "InnoDB", Encoding: "UTF8"},
 }
 
+// dialectAliases maps driver names that can be used in place of a dialect to
+// the dialect they speak. When one of these is configured as the dialect, it
+// is used as the driver instead.
+var dialectAliases = map[string]string{
+	"pgx":       "postgres",
+	"sqlserver": "mssql",
+}
+
+func init() {
+	migrate.RegisterErrorCodeExtractor(func(err error) (string, bool) {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) {
+			return strconv.Itoa(int(mysqlErr.Number)), true
+		}
+		return "", false
+	})
+	migrate.RegisterErrorCodeExtractor(func(err error) (string, bool) {
+		var sqliteErr sqlite3.Error
+		if errors.As(err, &sqliteErr) {
+			return strconv.Itoa(int(sqliteErr.ExtendedCode)), true
+		}
+		return "", false
+	})
+}
+
+var idSchemes = map[string]migrate.MigrationIdScheme{
+	"":         migrate.IdBaseName,
+	"basename": migrate.IdBaseName,
+	"path":     migrate.IdRelativePath,
+}
+
+var revertOrders = map[string]migrate.RevertOrder{
+	"":           migrate.RevertById,
+	"id":         migrate.RevertById,
+	"applied_at": migrate.RevertByAppliedAt,
+}
+
+var emptyDownPolicies = map[string]migrate.EmptyDownPolicy{
+	"":      migrate.EmptyDownAllow,
+	"allow": migrate.EmptyDownAllow,
+	"warn":  migrate.EmptyDownWarn,
+	"error": migrate.EmptyDownError,
+}
+
+// The block of the configuration file whose settings all environments
+// inherit.
+const configDefaults = "defaults"
+
+// Environment variables starting with this override the settings of the
+// environment, eg: SQL_MIGRATE_DATASOURCE.
+const configEnvPrefix = "SQL_MIGRATE_"
+
 var (
 	ConfigFile        string
 	ConfigEnvironment string
+
+	// Override the settings of the environment, so no configuration file is
+	// needed when they're given.
+	ConfigDialect    string
+	ConfigDataSource string
+	ConfigDir        string
 )
 
 func ConfigFlags(f *flag.FlagSet) {
 	f.StringVar(&ConfigFile, "config", "dbconfig.yml", "Configuration file to use.")
 	f.StringVar(&ConfigEnvironment, "env", "development", "Environment to use.")
+	f.StringVar(&ConfigDialect, "dialect", "", "Dialect, overrides the environment.")
+	f.StringVar(&ConfigDataSource, "dsn", "", "Data source, overrides the environment.")
+	f.StringVar(&ConfigDir, "dir", "", "Migrations directory, overrides the environment.")
 }
 
 type Environment struct {
-	Dialect       string `yaml:"dialect"`
-	DataSource    string `yaml:"datasource"`
-	Dir           string `yaml:"dir"`
-	TableName     string `yaml:"table"`
-	SchemaName    string `yaml:"schema"`
-	IgnoreUnknown bool   `yaml:"ignoreunknown"`
+	Dialect       string     `yaml:"dialect"`
+	Driver        string     `yaml:"driver"`
+	DataSource    string     `yaml:"datasource"`
+	Dir           string     `yaml:"dir"`
+	TableName     string     `yaml:"table"`
+	SchemaName    string     `yaml:"schema"`
+	IgnoreUnknown bool       `yaml:"ignoreunknown"`
+	Sequential    bool       `yaml:"sequential"`
+	Padding       int        `yaml:"padding"`
+	Recursive     bool       `yaml:"recursive"`
+	IdScheme      string     `yaml:"idscheme"`
+	Separator     string     `yaml:"separator"`
+	LegacySplit   bool       `yaml:"legacysplitting"`
+	StreamSize    int64      `yaml:"streamsize"`
+	RevertOrder   string     `yaml:"revertorder"`
+	EmptyDown     string     `yaml:"emptydown"`
+	Lint          LintConfig `yaml:"lint"`
+
+	DisableCreateTable bool `yaml:"disablecreatetable"`
+
+	// Safety policies, enforced by the commands that run migrations. See
+	// applyPolicyDefaults for their defaults.
+	Protected           bool  `yaml:"protected"`
+	AllowDown           *bool `yaml:"allow_down"`
+	MaxMigrationsPerRun int   `yaml:"max_migrations_per_run"`
+	RequireConfirmation *bool `yaml:"require_confirmation"`
 }
 
+// ReadConfig returns the environments of the configuration file, see
+// decodeEnvironment.
 func ReadConfig() (map[string]*Environment, error) {
-	file, err := os.ReadFile(ConfigFile)
+	raw, err := readRawConfig()
 	if err != nil {
 		return nil, err
 	}
 
 	config := make(map[string]*Environment)
-	err = yaml.Unmarshal(file, config)
+	for name := range raw {
+		if name == configDefaults {
+			continue
+		}
+		env, err := decodeEnvironment(raw, name)
+		if err != nil {
+			return nil, err
+		}
+		config[name] = env
+	}
+
+	return config, nil
+}
+
+// Reads the settings of each environment in the configuration file, before
+// they're merged with the defaults and decoded.
+func readRawConfig() (map[string]map[string]interface{}, error) {
+	file, err := os.ReadFile(ConfigFile)
 	if err != nil {
 		return nil, err
 	}
 
-	return config, nil
+	raw := make(map[string]map[string]interface{})
+	err = yaml.Unmarshal(file, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return raw, nil
+}
+
+// Decodes an environment. Its settings replace those of the defaults block,
+// environment variables are expanded in their values, and then the
+// SQL_MIGRATE_* environment variables and the flags override them.
+func decodeEnvironment(raw map[string]map[string]interface{}, name string) (*Environment, error) {
+	types := settingTypes()
+
+	settings := make(map[string]interface{})
+	for key, value := range raw[configDefaults] {
+		settings[key] = value
+	}
+	for key, value := range raw[name] {
+		settings[key] = value
+	}
+
+	for key, value := range settings {
+		if text, ok := value.(string); ok {
+			if expanded := expandEnv(text); expanded != text {
+				settings[key] = settingValue(types[key], expanded)
+			}
+		} else {
+			settings[key] = expandSettings(value)
+		}
+	}
+
+	for key, t := range types {
+		if value, ok := os.LookupEnv(configEnvPrefix + strings.ToUpper(key)); ok {
+			settings[key] = settingValue(t, value)
+		}
+	}
+
+	flags := map[string]string{
+		"dialect":    ConfigDialect,
+		"datasource": ConfigDataSource,
+		"dir":        ConfigDir,
+	}
+	for key, value := range flags {
+		if value != "" {
+			settings[key] = value
+		}
+	}
+
+	data, err := yaml.Marshal(settings)
+	if err != nil {
+		return nil, err
+	}
+	env := &Environment{}
+	if err := yaml.Unmarshal(data, env); err != nil {
+		// The lines are those of the merged settings, not of the file.
+		var typeErr *yaml.TypeError
+		if errors.As(err, &typeErr) {
+			problems := make([]string, len(typeErr.Errors))
+			for i, problem := range typeErr.Errors {
+				problems[i] = yamlLineRegex.ReplaceAllString(problem, "")
+			}
+			return nil, fmt.Errorf("Invalid environment %s: %s", name, strings.Join(problems, ", "))
+		}
+		return nil, fmt.Errorf("Invalid environment %s: %w", name, err)
+	}
+	return env, nil
+}
+
+var yamlLineRegex = regexp.MustCompile(`^line \d+: `)
+
+// Returns the type of each setting of an environment by its key.
+func settingTypes() map[string]reflect.Type {
+	types := make(map[string]reflect.Type)
+	t := reflect.TypeOf(Environment{})
+	for i := 0; i < t.NumField(); i++ {
+		if key := t.Field(i).Tag.Get("yaml"); key != "" {
+			types[key] = t.Field(i).Type
+		}
+	}
+	return types
+}
+
+// Returns a setting given as text. Settings that aren't text, like booleans
+// and numbers, are parsed like YAML.
+func settingValue(t reflect.Type, text string) interface{} {
+	if t == nil || t.Kind() == reflect.String {
+		return text
+	}
+
+	var value interface{}
+	if err := yaml.Unmarshal([]byte(text), &value); err != nil {
+		return text
+	}
+	return value
+}
+
+// Expands environment variables in the text of nested settings, like lint.
+func expandSettings(value interface{}) interface{} {
+	switch value := value.(type) {
+	case string:
+		return expandEnv(value)
+	case []interface{}:
+		for i, v := range value {
+			value[i] = expandSettings(v)
+		}
+	case map[interface{}]interface{}:
+		for k, v := range value {
+			value[k] = expandSettings(v)
+		}
+	}
+	return value
+}
+
+// Expands environment variables like os.ExpandEnv. ${VAR:-default} expands
+// to default when VAR is unset or empty.
+func expandEnv(text string) string {
+	return os.Expand(text, func(name string) string {
+		name, fallback, hasFallback := strings.Cut(name, ":-")
+		if value := os.Getenv(name); value != "" || !hasFallback {
+			return value
+		}
+		return fallback
+	})
+}
+
+// Whether the dialect is given by a flag or an environment variable, in which
+// case a configuration file isn't needed.
+func dialectGiven() bool {
+	return ConfigDialect != "" || os.Getenv(configEnvPrefix+"DIALECT") != ""
 }
 
 func GetEnvironment() (*Environment, error) {
-	config, err := ReadConfig()
+	raw, err := readRawConfig()
+	if errors.Is(err, fs.ErrNotExist) && dialectGiven() {
+		raw, err = nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	env := config[ConfigEnvironment]
-	if env == nil {
+	if _, ok := raw[ConfigEnvironment]; (!ok || ConfigEnvironment == configDefaults) && !dialectGiven() {
 		return nil, errors.New("No environment: " + ConfigEnvironment)
 	}
 
+	env, err := decodeEnvironment(raw, ConfigEnvironment)
+	if err != nil {
+		return nil, err
+	}
+
 	if env.Dialect == "" {
 		return nil, errors.New("No dialect specified")
 	}
 
+	if dialect, ok := dialectAliases[env.Dialect]; ok {
+		if env.Driver == "" {
+			env.Driver = env.Dialect
+		}
+		env.Dialect = dialect
+	}
+
+	if env.Driver == "" {
+		env.Driver = env.Dialect
+	}
+
 	if env.DataSource == "" {
 		return nil, errors.New("No data source specified")
 	}
-	env.DataSource = os.ExpandEnv(env.DataSource)
 
 	if env.Dir == "" {
 		env.Dir = "migrations"
 	}
 
+	if _, ok := idSchemes[env.IdScheme]; !ok {
+		return nil, fmt.Errorf("Unknown id scheme: %s (use basename or path)", env.IdScheme)
+	}
+
+	if _, ok := revertOrders[env.RevertOrder]; !ok {
+		return nil, fmt.Errorf("Unknown revert order: %s (use id or applied_at)", env.RevertOrder)
+	}
+
+	if _, ok := emptyDownPolicies[env.EmptyDown]; !ok {
+		return nil, fmt.Errorf("Unknown empty down policy: %s (use allow, warn or error)", env.EmptyDown)
+	}
+
+	if err := applyPolicyDefaults(env); err != nil {
+		return nil, err
+	}
+
 	if env.TableName != "" {
 		migrate.SetTable(env.TableName)
 	}
@@ -91,22 +361,74 @@ func GetEnvironment() (*Environment, error) {
 	}
 
 	migrate.SetIgnoreUnknown(env.IgnoreUnknown)
+	migrate.SetDisableCreateTable(env.DisableCreateTable)
+	migrate.SetRevertOrder(revertOrders[env.RevertOrder])
+	migrate.SetEmptyDownPolicy(emptyDownPolicies[env.EmptyDown])
 
 	return env, nil
 }
 
-func GetConnection(env *Environment) (*sql.DB, string, error) {
-	db, err := sql.Open(env.Dialect, env.DataSource)
-	if err != nil {
-		return nil, "", fmt.Errorf("Cannot connect to database: %w", err)
+// GetMigrationSource returns the source of the migrations of the environment.
+func GetMigrationSource(env *Environment) migrate.FileMigrationSource {
+	options := GetParseOptions(env)
+	return migrate.FileMigrationSource{
+		Dir:              env.Dir,
+		Recursive:        env.Recursive,
+		IdScheme:         idSchemes[env.IdScheme],
+		ParseOptions:     &options,
+		StreamLargerThan: env.StreamSize,
+	}
+}
+
+// GetMigrationSet returns a migration set with the options of the environment.
+func GetMigrationSet(env *Environment) migrate.MigrationSet {
+	return migrate.MigrationSet{
+		TableName:          env.TableName,
+		SchemaName:         env.SchemaName,
+		IgnoreUnknown:      env.IgnoreUnknown,
+		DisableCreateTable: env.DisableCreateTable,
+		RevertOrder:        revertOrders[env.RevertOrder],
+		EmptyDown:          emptyDownPolicies[env.EmptyDown],
+		Warn: func(err error) {
+			ui.Warn(err.Error())
+		},
+	}
+}
+
+func GetParseOptions(env *Environment) sqlparse.ParseOptions {
+	options := sqlparse.DefaultParseOptions()
+	if env.Separator != "" {
+		options.Separator = env.Separator
+	}
+	if env.LegacySplit {
+		options.LegacyStatementSplitting = true
 	}
+	// Backslashes escape in MySQL strings, unless NO_BACKSLASH_ESCAPES is set.
+	options.BackslashEscapes = env.Dialect == "mysql"
+	return options
+}
 
-	// Make sure we only accept dialects that were compiled in.
+func GetConnection(env *Environment) (*sql.DB, string, error) {
+	// Make sure we only accept dialects and drivers that were compiled in.
 	_, exists := dialects[env.Dialect]
 	if !exists {
 		return nil, "", fmt.Errorf("Unsupported dialect: %s", env.Dialect)
 	}
 
+	driver := env.Driver
+	if driver == "" {
+		driver = env.Dialect
+	}
+	if !slices.Contains(sql.Drivers(), driver) {
+		return nil, "", fmt.Errorf("Unsupported driver: %s (not compiled into this binary, available drivers: %s)",
+			driver, strings.Join(sql.Drivers(), ", "))
+	}
+
+	db, err := sql.Open(driver, env.DataSource)
+	if err != nil {
+		return nil, "", fmt.Errorf("Cannot connect to database: %w", err)
+	}
+
 	return db, env.Dialect, nil
 }
 
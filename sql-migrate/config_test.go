@@ -0,0 +1,206 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+
+	migrate "github.com/rubenv/sql-migrate"
+	"github.com/rubenv/sql-migrate/sqlparse"
+)
+
+type ConfigSuite struct{}
+
+var _ = Suite(&ConfigSuite{})
+
+func (*ConfigSuite) TearDownTest(*C) {
+	ConfigDialect, ConfigDataSource, ConfigDir = "", "", ""
+}
+
+func (*ConfigSuite) writeConfig(c *C, content string) {
+	ConfigFile = filepath.Join(c.MkDir(), "dbconfig.yml")
+	ConfigEnvironment = "development"
+	c.Assert(os.WriteFile(ConfigFile, []byte(content), 0o600), IsNil)
+}
+
+func (s *ConfigSuite) TestDriverDefaultsToDialect(c *C) {
+	s.writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: test.db
+`)
+	env, err := GetEnvironment()
+	c.Assert(err, IsNil)
+	c.Assert(env.Dialect, Equals, "sqlite3")
+	c.Assert(env.Driver, Equals, "sqlite3")
+}
+
+func (s *ConfigSuite) TestDriverSeparateFromDialect(c *C) {
+	s.writeConfig(c, `
+development:
+  dialect: postgres
+  driver: pgx
+  datasource: dbname=test
+`)
+	env, err := GetEnvironment()
+	c.Assert(err, IsNil)
+	c.Assert(env.Dialect, Equals, "postgres")
+	c.Assert(env.Driver, Equals, "pgx")
+}
+
+func (s *ConfigSuite) TestDialectAlias(c *C) {
+	s.writeConfig(c, `
+development:
+  dialect: sqlserver
+  datasource: sqlserver://localhost
+`)
+	env, err := GetEnvironment()
+	c.Assert(err, IsNil)
+	c.Assert(env.Dialect, Equals, "mssql")
+	c.Assert(env.Driver, Equals, "sqlserver")
+}
+
+func (*ConfigSuite) TestUnsupportedDriver(c *C) {
+	_, _, err := GetConnection(&Environment{
+		Dialect:    "postgres",
+		Driver:     "nosuchdriver",
+		DataSource: "dbname=test",
+	})
+	c.Assert(err, ErrorMatches, "Unsupported driver: nosuchdriver .*")
+}
+
+func (s *ConfigSuite) TestMigrationSource(c *C) {
+	s.writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: test.db
+  recursive: true
+  idscheme: path
+  separator: GO
+`)
+	env, err := GetEnvironment()
+	c.Assert(err, IsNil)
+	c.Assert(GetMigrationSource(env), DeepEquals, migrate.FileMigrationSource{
+		Dir:          "migrations",
+		Recursive:    true,
+		IdScheme:     migrate.IdRelativePath,
+		ParseOptions: &sqlparse.ParseOptions{Separator: "GO"},
+	})
+
+	s.writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: test.db
+  idscheme: full
+`)
+	_, err = GetEnvironment()
+	c.Assert(err, ErrorMatches, "Unknown id scheme: full .*")
+}
+
+func (s *ConfigSuite) TestDefaultsAndExpansion(c *C) {
+	c.Assert(os.Setenv("SQL_MIGRATE_TEST_HOST", "db.example.com"), IsNil)
+	defer os.Unsetenv("SQL_MIGRATE_TEST_HOST")
+
+	s.writeConfig(c, `
+defaults:
+  dialect: postgres
+  dir: ${SQL_MIGRATE_TEST_DIR:-db/migrations}
+  table: schema_migrations
+  disablecreatetable: true
+development:
+  datasource: host=${SQL_MIGRATE_TEST_HOST} dbname=app
+  table: dev_migrations
+  max_migrations_per_run: ${SQL_MIGRATE_TEST_MAX:-3}
+  lint:
+    disable: ["${SQL_MIGRATE_TEST_RULE:-missing-down}"]
+`)
+	env, err := GetEnvironment()
+	c.Assert(err, IsNil)
+	c.Assert(env.Dialect, Equals, "postgres")
+	c.Assert(env.DataSource, Equals, "host=db.example.com dbname=app")
+	c.Assert(env.Dir, Equals, "db/migrations")
+	c.Assert(env.TableName, Equals, "dev_migrations")
+	c.Assert(env.MaxMigrationsPerRun, Equals, 3)
+	c.Assert(env.Lint.Disable, DeepEquals, []string{"missing-down"})
+	c.Assert(GetMigrationSet(env).DisableCreateTable, Equals, true)
+
+	config, err := ReadConfig()
+	c.Assert(err, IsNil)
+	c.Assert(config, HasLen, 1)
+
+	ConfigEnvironment = "defaults"
+	_, err = GetEnvironment()
+	c.Assert(err, ErrorMatches, "No environment: defaults")
+}
+
+func (s *ConfigSuite) TestEnvironmentVariables(c *C) {
+	for key, value := range map[string]string{
+		"SQL_MIGRATE_DATASOURCE":    "other.db",
+		"SQL_MIGRATE_IGNOREUNKNOWN": "true",
+		"SQL_MIGRATE_STREAMSIZE":    "1024",
+		"SQL_MIGRATE_ALLOW_DOWN":    "false",
+	} {
+		c.Assert(os.Setenv(key, value), IsNil)
+		defer os.Unsetenv(key)
+	}
+
+	s.writeConfig(c, `
+development:
+  dialect: sqlite3
+  datasource: test.db
+`)
+	env, err := GetEnvironment()
+	c.Assert(err, IsNil)
+	c.Assert(env.DataSource, Equals, "other.db")
+	c.Assert(env.IgnoreUnknown, Equals, true)
+	c.Assert(env.StreamSize, Equals, int64(1024))
+	c.Assert(*env.AllowDown, Equals, false)
+
+	c.Assert(os.Setenv("SQL_MIGRATE_PADDING", "wide"), IsNil)
+	defer os.Unsetenv("SQL_MIGRATE_PADDING")
+	_, err = GetEnvironment()
+	c.Assert(err, ErrorMatches, "Invalid environment development: cannot unmarshal !!str `wide` into int")
+}
+
+func (s *ConfigSuite) TestWithoutConfigFile(c *C) {
+	ConfigFile = filepath.Join(c.MkDir(), "dbconfig.yml")
+	ConfigEnvironment = "development"
+
+	_, err := GetEnvironment()
+	c.Assert(err, ErrorMatches, "open .*: no such file or directory")
+
+	ConfigDialect, ConfigDataSource, ConfigDir = "sqlite3", "test.db", "db"
+	env, err := GetEnvironment()
+	c.Assert(err, IsNil)
+	c.Assert(env.Dialect, Equals, "sqlite3")
+	c.Assert(env.DataSource, Equals, "test.db")
+	c.Assert(env.Dir, Equals, "db")
+
+	// Flags win over the configuration file.
+	s.writeConfig(c, `
+development:
+  dialect: postgres
+  datasource: dbname=test
+`)
+	ConfigDialect, ConfigDir = "", ""
+	env, err = GetEnvironment()
+	c.Assert(err, IsNil)
+	c.Assert(env.Dialect, Equals, "postgres")
+	c.Assert(env.DataSource, Equals, "test.db")
+}
+
+func (s *ConfigSuite) TestParseOptions(c *C) {
+	s.writeConfig(c, `
+development:
+  dialect: mysql
+  datasource: root@/test
+  legacysplitting: true
+`)
+	env, err := GetEnvironment()
+	c.Assert(err, IsNil)
+	options := GetParseOptions(env)
+	c.Assert(options.BackslashEscapes, Equals, true)
+	c.Assert(options.LegacyStatementSplitting, Equals, true)
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/rubenv/sql-migrate/sqlparse"
+)
+
+// LintConfig configures the lint command for an environment.
+type LintConfig struct {
+	// Disable lists the rules that are not checked.
+	Disable []string `yaml:"disable"`
+}
+
+type lintProblem struct {
+	Migration string `json:"migration" yaml:"migration"`
+	File      string `json:"file" yaml:"file"`
+	// Statement is the 1-based index of the Up statement, 0 when the problem
+	// concerns the migration as a whole. Line is the line it starts at in the
+	// file, 0 when unknown.
+	Statement int    `json:"statement,omitempty" yaml:"statement,omitempty"`
+	Line      int    `json:"line,omitempty" yaml:"line,omitempty"`
+	Rule      string `json:"rule" yaml:"rule"`
+	Message   string `json:"message" yaml:"message"`
+}
+
+func (p lintProblem) String() string {
+	if p.Statement == 0 {
+		return fmt.Sprintf("%s: %s: %s", p.Migration, p.Rule, p.Message)
+	}
+	return fmt.Sprintf("%s: Up statement %d: %s: %s", p.Migration, p.Statement, p.Rule, p.Message)
+}
+
+type lintRule struct {
+	Name    string
+	Message string
+
+	// Dialects the rule applies to, all of them when empty.
+	Dialects []string
+
+	// Either Statement checks every normalized Up statement, or Migration
+	// checks the migration as a whole.
+	Statement func(stmt string, m *sqlparse.ParsedMigration) bool
+	Migration func(m *sqlparse.ParsedMigration) bool
+}
+
+var lintRules = []lintRule{
+	{
+		Name:      "drop-table",
+		Message:   "Dropping a table loses its data",
+		Statement: statementMatches(`^DROP TABLE\b`, ""),
+	},
+	{
+		Name:      "drop-column",
+		Message:   "Dropping a column loses its data and breaks code still using it",
+		Statement: alterClause(matches(`^DROP COLUMN\b`, "")),
+	},
+	{
+		Name:      "not-null-without-default",
+		Message:   "Adding a NOT NULL column without a default fails when the table has rows",
+		Statement: alterClause(matches(`^ADD (COLUMN )?(IF NOT EXISTS )?\S+ .*\bNOT NULL\b`, `^ADD (CONSTRAINT|PRIMARY|UNIQUE|INDEX|KEY|FOREIGN|CHECK)\b|\bDEFAULT\b`)),
+	},
+	{
+		Name:      "index-without-concurrently",
+		Message:   "Creating an index without CONCURRENTLY blocks writes to the table",
+		Dialects:  []string{"postgres"},
+		Statement: statementMatches(`^CREATE (UNIQUE )?INDEX\b`, `^CREATE (UNIQUE )?INDEX CONCURRENTLY\b`),
+	},
+	{
+		Name:     "concurrently-in-transaction",
+		Message:  "CONCURRENTLY cannot run inside a transaction, use -- +migrate Up notransaction",
+		Dialects: []string{"postgres"},
+		Statement: func(stmt string, m *sqlparse.ParsedMigration) bool {
+			return !m.DisableTransactionUp && concurrentlyRegex.MatchString(stmt)
+		},
+	},
+	{
+		Name:    "column-type-change",
+		Message: "Changing the type of a column rewrites the table and can lose data",
+		Statement: alterClause(func(clause string) bool {
+			// Postgres and MySQL, then SQL Server which only names the new type.
+			return columnTypeRegex.MatchString(clause) || mssqlColumnType(clause)
+		}),
+	},
+	{
+		Name:      "update-without-where",
+		Message:   "UPDATE without a WHERE clause changes every row",
+		Statement: statementMatches(`^UPDATE\b`, `\bWHERE\b`),
+	},
+	{
+		Name:      "delete-without-where",
+		Message:   "DELETE without a WHERE clause removes every row",
+		Statement: statementMatches(`^DELETE\b`, `\bWHERE\b`),
+	},
+	{
+		Name:    "missing-down",
+		Message: "The migration has no Down section, so it cannot be undone",
+		Migration: func(m *sqlparse.ParsedMigration) bool {
+			return !m.HasDown
+		},
+	},
+}
+
+var (
+	concurrentlyRegex = regexp.MustCompile(`\bCONCURRENTLY\b`)
+	alterTableRegex   = regexp.MustCompile(`^ALTER TABLE (IF EXISTS )?(ONLY )?\S+ `)
+	columnTypeRegex   = regexp.MustCompile(`^(ALTER (COLUMN )?\S+ (SET DATA )?TYPE|MODIFY|CHANGE)\b`)
+	mssqlColumnType   = matches(`^ALTER COLUMN \S+ \S+`, `^ALTER COLUMN \S+ (SET|DROP|ADD|RESET|RESTART|OPTIONS)\b`)
+)
+
+func findLintRule(name string) *lintRule {
+	for i := range lintRules {
+		if lintRules[i].Name == name {
+			return &lintRules[i]
+		}
+	}
+	return nil
+}
+
+// Returns a check for text that matches the pattern, unless it matches the
+// exception.
+func matches(pattern, exception string) func(string) bool {
+	re := regexp.MustCompile(pattern)
+	if exception == "" {
+		return re.MatchString
+	}
+	except := regexp.MustCompile(exception)
+	return func(s string) bool {
+		return re.MatchString(s) && !except.MatchString(s)
+	}
+}
+
+func statementMatches(pattern, exception string) func(string, *sqlparse.ParsedMigration) bool {
+	match := matches(pattern, exception)
+	return func(stmt string, _ *sqlparse.ParsedMigration) bool {
+		return match(stmt)
+	}
+}
+
+// Returns a check for ALTER TABLE statements with a clause that matches.
+func alterClause(match func(clause string) bool) func(string, *sqlparse.ParsedMigration) bool {
+	return func(stmt string, _ *sqlparse.ParsedMigration) bool {
+		prefix := alterTableRegex.FindString(stmt)
+		if prefix == "" {
+			return false
+		}
+		for _, clause := range splitClauses(stmt[len(prefix):]) {
+			if match(clause) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Splits on the commas that are not between parentheses.
+func splitClauses(s string) []string {
+	var clauses []string
+	depth := 0
+	start := 0
+	for i, r := range s {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				clauses = append(clauses, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	return append(clauses, strings.TrimSpace(s[start:]))
+}
+
+var (
+	lineCommentRegex  = regexp.MustCompile(`--[^\n]*`)
+	blockCommentRegex = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	stringRegex       = regexp.MustCompile(`'(?:[^']|'')*'`)
+	whitespaceRegex   = regexp.MustCompile(`\s+`)
+)
+
+// Strips comments and string contents, and collapses whitespace, so rules
+// can match keywords with simple patterns.
+func normalizeStatement(stmt string) string {
+	stmt = stringRegex.ReplaceAllString(stmt, "''")
+	stmt = lineCommentRegex.ReplaceAllString(stmt, "")
+	stmt = blockCommentRegex.ReplaceAllString(stmt, "")
+	stmt = whitespaceRegex.ReplaceAllString(stmt, " ")
+	stmt = strings.TrimSpace(stmt)
+	stmt = strings.TrimSuffix(stmt, ";")
+	return strings.ToUpper(strings.TrimSpace(stmt))
+}
+
+// Checks a parsed migration against all enabled rules for the dialect.
+func lintMigration(id, file, dialect string, m *sqlparse.ParsedMigration, disabled []string) []lintProblem {
+	var problems []lintProblem
+
+	for _, rule := range lintRules {
+		if slices.Contains(disabled, rule.Name) || slices.Contains(m.LintIgnore, rule.Name) {
+			continue
+		}
+		if len(rule.Dialects) > 0 && !slices.Contains(rule.Dialects, dialect) {
+			continue
+		}
+
+		if rule.Migration != nil && rule.Migration(m) {
+			problems = append(problems, lintProblem{
+				Migration: id,
+				File:      file,
+				Rule:      rule.Name,
+				Message:   rule.Message,
+			})
+		}
+
+		if rule.Statement != nil {
+			for i, stmt := range m.UpStatements {
+				if rule.Statement(normalizeStatement(stmt), m) {
+					line := 0
+					if len(m.UpPositions) == len(m.UpStatements) {
+						line = m.UpPositions[i].StartLine
+					}
+					problems = append(problems, lintProblem{
+						Migration: id,
+						File:      file,
+						Statement: i + 1,
+						Line:      line,
+						Rule:      rule.Name,
+						Message:   rule.Message,
+					})
+				}
+			}
+		}
+	}
+
+	slices.SortStableFunc(problems, func(a, b lintProblem) int {
+		return a.Statement - b.Statement
+	})
+	return problems
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/cli"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+
+	"github.com/rubenv/sql-migrate/sqlparse"
+)
+
+type LintSuite struct{}
+
+var _ = Suite(&LintSuite{})
+
+func (*LintSuite) lint(c *C, dialect, migration string, disabled ...string) []string {
+	parsed, err := sqlparse.ParseMigration(strings.NewReader(migration))
+	c.Assert(err, IsNil)
+
+	var found []string
+	for _, p := range lintMigration("1_test.sql", "migrations/1_test.sql", dialect, parsed, disabled) {
+		found = append(found, p.String())
+	}
+	return found
+}
+
+func (s *LintSuite) TestRules(c *C) {
+	tests := []struct {
+		dialect   string
+		statement string
+		rule      string
+	}{
+		{"sqlite3", "DROP TABLE people;", "drop-table"},
+		{"sqlite3", "drop table if exists people;", "drop-table"},
+		{"postgres", "ALTER TABLE people DROP COLUMN name;", "drop-column"},
+		{"postgres", "ALTER TABLE people ADD COLUMN age int NOT NULL;", "not-null-without-default"},
+		{"mysql", "ALTER TABLE people ADD age int, ADD name text NOT NULL;", "not-null-without-default"},
+		{"postgres", "ALTER TABLE people ADD COLUMN age int NOT NULL DEFAULT 0;", ""},
+		{"postgres", "ALTER TABLE people ADD CONSTRAINT c CHECK (age IS NOT NULL);", ""},
+		{"postgres", "CREATE INDEX people_name ON people (name);", "index-without-concurrently"},
+		{"sqlite3", "CREATE INDEX people_name ON people (name);", ""},
+		{"postgres", "CREATE UNIQUE INDEX CONCURRENTLY people_name ON people (name);", "concurrently-in-transaction"},
+		{"postgres", "ALTER TABLE people ALTER COLUMN age TYPE bigint;", "column-type-change"},
+		{"postgres", "ALTER TABLE people ALTER COLUMN age SET DATA TYPE bigint;", "column-type-change"},
+		{"postgres", "ALTER TABLE people ALTER COLUMN age SET NOT NULL;", ""},
+		{"mysql", "ALTER TABLE people MODIFY COLUMN age bigint;", "column-type-change"},
+		{"mssql", "ALTER TABLE people ALTER COLUMN age bigint;", "column-type-change"},
+		{"sqlite3", "UPDATE people SET age = 0;", "update-without-where"},
+		{"sqlite3", "UPDATE people SET age = 0 WHERE age IS NULL;", ""},
+		{"sqlite3", "UPDATE people SET name = 'where';", "update-without-where"},
+		{"sqlite3", "DELETE FROM people;", "delete-without-where"},
+		{"sqlite3", "DELETE FROM people -- WHERE id = 1\n;", "delete-without-where"},
+		{"sqlite3", "DELETE FROM people WHERE id = 1;", ""},
+	}
+
+	for _, test := range tests {
+		found := s.lint(c, test.dialect, "-- +migrate Up\n"+test.statement+"\n-- +migrate Down\n")
+		if test.rule == "" {
+			c.Check(found, HasLen, 0, Commentf("%s", test.statement))
+		} else {
+			c.Check(found, DeepEquals, []string{
+				"1_test.sql: Up statement 1: " + test.rule + ": " + findLintRule(test.rule).Message,
+			}, Commentf("%s", test.statement))
+		}
+	}
+}
+
+func (s *LintSuite) TestConcurrentlyWithoutTransaction(c *C) {
+	found := s.lint(c, "postgres", `-- +migrate Up notransaction
+CREATE INDEX CONCURRENTLY people_name ON people (name);
+
+-- +migrate Down notransaction
+DROP INDEX CONCURRENTLY people_name;
+`)
+	c.Assert(found, HasLen, 0)
+}
+
+func (s *LintSuite) TestMissingDown(c *C) {
+	found := s.lint(c, "sqlite3", `-- +migrate Up
+CREATE TABLE people (id int);
+`)
+	c.Assert(found, DeepEquals, []string{
+		"1_test.sql: missing-down: The migration has no Down section, so it cannot be undone",
+	})
+
+	found = s.lint(c, "sqlite3", `-- +migrate Up
+CREATE TABLE people (id int);
+
+-- +migrate Down
+-- Nothing to undo.
+`)
+	c.Assert(found, HasLen, 0)
+}
+
+func (s *LintSuite) TestSuppressed(c *C) {
+	migration := `-- +migrate Lint ignore=drop-table
+-- +migrate Up
+DROP TABLE people;
+DELETE FROM places;
+`
+	found := s.lint(c, "sqlite3", migration, "missing-down")
+	c.Assert(found, HasLen, 1)
+	c.Assert(found[0], Matches, "1_test.sql: Up statement 2: delete-without-where: .*")
+
+	found = s.lint(c, "sqlite3", migration, "missing-down", "delete-without-where")
+	c.Assert(found, HasLen, 0)
+}
+
+func (*LintSuite) TestGithubAnnotations(c *C) {
+	parsed, err := sqlparse.ParseMigration(strings.NewReader(`-- +migrate Up
+CREATE TABLE people (id int);
+
+DROP TABLE places;
+`))
+	c.Assert(err, IsNil)
+	problems := lintMigration("1_test.sql", "migrations/1_test.sql", "sqlite3", parsed, nil)
+	c.Assert(problems, HasLen, 2)
+	c.Assert(problems[1].Line, Equals, 4)
+
+	out := &bytes.Buffer{}
+	ui = &cli.BasicUi{Writer: out, ErrorWriter: out}
+	OutputFormat = outputGithub
+	defer func() { OutputFormat = outputText }()
+	c.Assert(printLintProblems(problems), IsNil)
+	c.Assert(out.String(), Equals, `::error file=migrations/1_test.sql,title=missing-down::The migration has no Down section, so it cannot be undone
+::error file=migrations/1_test.sql,line=4,title=drop-table::Up statement 2: Dropping a table loses its data
+`)
+}
+
+func (*LintSuite) TestUnknownRuleInMigration(c *C) {
+	dir := c.MkDir()
+	c.Assert(os.WriteFile(filepath.Join(dir, "1_test.sql"),
+		[]byte("-- +migrate Lint ignore=drop-tables\n-- +migrate Up\nDROP TABLE people;\n"), 0o600), IsNil)
+	ConfigFile = filepath.Join(dir, "dbconfig.yml")
+	ConfigEnvironment = "development"
+	c.Assert(os.WriteFile(ConfigFile, []byte("development:\n  dialect: sqlite3\n  datasource: test.db\n  dir: "+dir+"\n"), 0o600), IsNil)
+
+	_, err := LintMigrations(nil)
+	c.Assert(err, ErrorMatches, `Unknown lint rule in migration \(1_test.sql\): drop-tables`)
+}
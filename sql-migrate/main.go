@@ -25,15 +25,36 @@ func realMain() int {
 			"down": func() (cli.Command, error) {
 				return &DownCommand{}, nil
 			},
+			"apply": func() (cli.Command, error) {
+				return &ApplyCommand{}, nil
+			},
+			"goto": func() (cli.Command, error) {
+				return &GotoCommand{}, nil
+			},
+			"lint": func() (cli.Command, error) {
+				return &LintCommand{}, nil
+			},
+			"plan": func() (cli.Command, error) {
+				return &PlanCommand{}, nil
+			},
 			"redo": func() (cli.Command, error) {
 				return &RedoCommand{}, nil
 			},
+			"squash": func() (cli.Command, error) {
+				return &SquashCommand{}, nil
+			},
 			"status": func() (cli.Command, error) {
 				return &StatusCommand{}, nil
 			},
 			"new": func() (cli.Command, error) {
 				return &NewCommand{}, nil
 			},
+			"renumber": func() (cli.Command, error) {
+				return &RenumberCommand{}, nil
+			},
+			"validate": func() (cli.Command, error) {
+				return &ValidateCommand{}, nil
+			},
 			"skip": func() (cli.Command, error) {
 				return &SkipCommand{}, nil
 			},
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+// Exit codes. In text output, commands exit with exitSuccess whether or not
+// they changed anything. With -output json or yaml, commands that apply
+// migrations exit with exitChanged when they applied (or with -dryrun, would
+// apply) any, so pipelines can tell that apart from having nothing to do.
+const (
+	exitSuccess = 0
+	exitFailure = 1
+	exitChanged = 2
+)
+
+type outputFormat string
+
+const (
+	outputText outputFormat = "text"
+	outputJSON outputFormat = "json"
+	outputYAML outputFormat = "yaml"
+
+	// GitHub workflow annotations, only for the lint command.
+	outputGithub outputFormat = "github"
+)
+
+// Whether a document is written instead of text.
+func (f outputFormat) structured() bool {
+	return f == outputJSON || f == outputYAML
+}
+
+var OutputFormat = outputText
+
+// The -output flag, which sets OutputFormat to one of the formats a command
+// accepts.
+type outputFlag []outputFormat
+
+func (outputFlag) String() string {
+	return string(OutputFormat)
+}
+
+func (formats outputFlag) Set(value string) error {
+	if !slices.Contains(formats, outputFormat(value)) {
+		return fmt.Errorf("Unknown output format: %s (use %s)", value, formats.list())
+	}
+	OutputFormat = outputFormat(value)
+	return nil
+}
+
+// Lists the formats, eg: "text, json or yaml".
+func (formats outputFlag) list() string {
+	names := make([]string, len(formats))
+	for i, format := range formats {
+		names[i] = string(format)
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+// Adds the -output flag, which accepts text, json, yaml and the extra formats.
+func OutputFlags(f *flag.FlagSet, extra ...outputFormat) {
+	formats := append(outputFlag{outputText, outputJSON, outputYAML}, extra...)
+	f.Var(formats, "output", "Output format: "+formats.list()+".")
+}
+
+// Writes v as a document in the output format.
+func writeOutput(v interface{}) error {
+	var data []byte
+	var err error
+	if OutputFormat == outputYAML {
+		data, err = yaml.Marshal(v)
+	} else {
+		data, err = json.MarshalIndent(v, "", "  ")
+	}
+	if err != nil {
+		return err
+	}
+
+	ui.Output(strings.TrimSuffix(string(data), "\n"))
+	return nil
+}
+
+// The document written by the commands that apply migrations.
+type runOutput struct {
+	Command    string             `json:"command" yaml:"command"`
+	DryRun     bool               `json:"dry_run" yaml:"dry_run"`
+	Migrations []*migrationOutput `json:"migrations" yaml:"migrations"`
+	Duration   float64            `json:"duration_seconds" yaml:"duration_seconds"`
+	Error      *errorOutput       `json:"error,omitempty" yaml:"error,omitempty"`
+
+	start time.Time
+}
+
+// Status of a migration in a runOutput.
+const (
+	statusApplied = "applied"
+	statusFailed  = "failed"
+	statusPlanned = "planned"
+	statusSkipped = "skipped"
+)
+
+type migrationOutput struct {
+	Id         string   `json:"id" yaml:"id"`
+	Direction  string   `json:"direction" yaml:"direction"`
+	Status     string   `json:"status" yaml:"status"`
+	Statements []string `json:"statements,omitempty" yaml:"statements,omitempty"`
+	Duration   float64  `json:"duration_seconds,omitempty" yaml:"duration_seconds,omitempty"`
+}
+
+type errorOutput struct {
+	Message        string `json:"message" yaml:"message"`
+	Migration      string `json:"migration,omitempty" yaml:"migration,omitempty"`
+	StatementIndex *int   `json:"statement_index,omitempty" yaml:"statement_index,omitempty"`
+	Line           int    `json:"line,omitempty" yaml:"line,omitempty"`
+	Statement      string `json:"statement,omitempty" yaml:"statement,omitempty"`
+	Code           string `json:"code,omitempty" yaml:"code,omitempty"`
+}
+
+func newRunOutput(command string, dryrun bool) *runOutput {
+	return &runOutput{
+		Command:    command,
+		DryRun:     dryrun,
+		Migrations: []*migrationOutput{},
+		start:      time.Now(),
+	}
+}
+
+// Adds a migration that would be applied with -dryrun. In text output, it is
+// printed instead.
+func (o *runOutput) addPlanned(m *migrate.PlannedMigration, dir migrate.MigrationDirection) error {
+	if !OutputFormat.structured() {
+		PrintMigration(m, dir)
+		return nil
+	}
+
+	migration := &migrationOutput{
+		Id:         m.Id,
+		Direction:  dir.String(),
+		Status:     statusPlanned,
+		Statements: []string{},
+	}
+	for stmt, err := range m.Statements(dir) {
+		if err != nil {
+			return err
+		}
+		migration.Statements = append(migration.Statements, stmt.SQL)
+	}
+	o.Migrations = append(o.Migrations, migration)
+	return nil
+}
+
+// Returns the migration set of env, which records the migrations it applies
+// in o.
+func (o *runOutput) migrationSet(env *Environment) migrate.MigrationSet {
+	ms := GetMigrationSet(env)
+	ms.Instrumentation = &runRecorder{output: o}
+	return ms
+}
+
+// Writes the document in structured output, or err in text output. Returns
+// the exit code.
+func reportRun(o *runOutput, err error) int {
+	if !OutputFormat.structured() {
+		if err != nil {
+			ui.Error(err.Error())
+			return exitFailure
+		}
+		return exitSuccess
+	}
+
+	o.Duration = time.Since(o.start).Seconds()
+	if err != nil {
+		o.Error = newErrorOutput(err)
+	}
+	if err := writeOutput(o); err != nil {
+		ui.Error(err.Error())
+		return exitFailure
+	}
+
+	switch {
+	case err != nil:
+		return exitFailure
+	case len(o.Migrations) > 0:
+		return exitChanged
+	default:
+		return exitSuccess
+	}
+}
+
+func newErrorOutput(err error) *errorOutput {
+	output := &errorOutput{Message: err.Error()}
+
+	var txErr *migrate.TxError
+	if errors.As(err, &txErr) {
+		if txErr.Migration != nil {
+			output.Migration = txErr.Migration.Id
+		}
+		if txErr.StatementIndex >= 0 {
+			index := txErr.StatementIndex
+			output.StatementIndex = &index
+		}
+		output.Line = txErr.Position.StartLine
+		output.Statement = txErr.Statement
+		output.Code = txErr.Code
+	}
+
+	return output
+}
+
+// Records the migrations that are applied in a runOutput.
+type runRecorder struct {
+	output *runOutput
+	start  time.Time
+}
+
+func (*runRecorder) StartRun(ctx context.Context, _ migrate.RunInfo) context.Context {
+	return ctx
+}
+
+func (*runRecorder) EndRun(context.Context, migrate.RunInfo, int, error) {}
+
+func (r *runRecorder) StartMigration(ctx context.Context, _ migrate.MigrationInfo) context.Context {
+	r.start = time.Now()
+	return ctx
+}
+
+func (r *runRecorder) EndMigration(_ context.Context, migration migrate.MigrationInfo, err error) {
+	status := statusApplied
+	if err != nil {
+		status = statusFailed
+	}
+	r.output.Migrations = append(r.output.Migrations, &migrationOutput{
+		Id:        migration.Id,
+		Direction: migration.Direction.String(),
+		Status:    status,
+		Duration:  time.Since(r.start).Seconds(),
+	})
+}
+
+func (*runRecorder) StartStatement(ctx context.Context, _ migrate.StatementInfo) context.Context {
+	return ctx
+}
+
+func (*runRecorder) EndStatement(context.Context, migrate.StatementInfo, int64, error) {}
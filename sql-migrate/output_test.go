@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/mitchellh/cli"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+type OutputSuite struct {
+	out *bytes.Buffer
+}
+
+var _ = Suite(&OutputSuite{})
+
+func (s *OutputSuite) SetUpTest(c *C) {
+	dir := c.MkDir()
+	c.Assert(os.Mkdir(filepath.Join(dir, "migrations"), 0o700), IsNil)
+	c.Assert(os.WriteFile(filepath.Join(dir, "migrations", "1_people.sql"),
+		[]byte("-- +migrate Up\nCREATE TABLE people (id int);\n-- +migrate Down\nDROP TABLE people;\n"), 0o600), IsNil)
+
+	ConfigFile = filepath.Join(dir, "dbconfig.yml")
+	ConfigEnvironment = "development"
+	config := "development:\n  dialect: sqlite3\n  datasource: " + filepath.Join(dir, "test.db") +
+		"\n  dir: " + filepath.Join(dir, "migrations") + "\n"
+	c.Assert(os.WriteFile(ConfigFile, []byte(config), 0o600), IsNil)
+
+	s.out = &bytes.Buffer{}
+	ui = &cli.BasicUi{Writer: s.out, ErrorWriter: s.out}
+	OutputFormat = outputJSON
+}
+
+func (*OutputSuite) TearDownTest(*C) {
+	OutputFormat = outputText
+}
+
+// Decodes the document written by reportRun.
+func (s *OutputSuite) decode(c *C, code int) (int, runOutput) {
+	var result runOutput
+	c.Assert(json.Unmarshal(s.out.Bytes(), &result), IsNil)
+	s.out.Reset()
+	return code, result
+}
+
+func (s *OutputSuite) TestApply(c *C) {
+	code, result := s.decode(c, reportRun(ApplyMigrations(migrate.Up, true, 0, -1)))
+	c.Assert(code, Equals, exitChanged)
+	c.Assert(result.DryRun, Equals, true)
+	c.Assert(result.Migrations, HasLen, 1)
+	c.Assert(result.Migrations[0].Status, Equals, statusPlanned)
+	c.Assert(result.Migrations[0].Statements, DeepEquals, []string{"CREATE TABLE people (id int);\n"})
+
+	code, result = s.decode(c, reportRun(ApplyMigrations(migrate.Up, false, 0, -1)))
+	c.Assert(code, Equals, exitChanged)
+	c.Assert(result.Migrations, HasLen, 1)
+	c.Assert(*result.Migrations[0], DeepEquals, migrationOutput{
+		Id:        "1_people.sql",
+		Direction: "up",
+		Status:    statusApplied,
+		Duration:  result.Migrations[0].Duration,
+	})
+	c.Assert(result.Error, IsNil)
+
+	code, result = s.decode(c, reportRun(ApplyMigrations(migrate.Up, false, 0, -1)))
+	c.Assert(code, Equals, exitSuccess)
+	c.Assert(result.Migrations, HasLen, 0)
+
+	code, result = s.decode(c, reportRun(RedoMigration(false)))
+	c.Assert(code, Equals, exitChanged)
+	c.Assert(result.Migrations, HasLen, 2)
+	c.Assert(result.Migrations[0].Direction, Equals, "down")
+	c.Assert(result.Migrations[1].Direction, Equals, "up")
+}
+
+func (s *OutputSuite) TestFailure(c *C) {
+	c.Assert(os.WriteFile(filepath.Join(filepath.Dir(ConfigFile), "migrations", "2_broken.sql"),
+		[]byte("-- +migrate Up\nSELECT 1;\nSELECT * FROM nope;\n"), 0o600), IsNil)
+
+	code, result := s.decode(c, reportRun(ApplyMigrations(migrate.Up, false, 0, -1)))
+	c.Assert(code, Equals, exitFailure)
+	c.Assert(result.Migrations, HasLen, 2)
+	c.Assert(result.Migrations[1].Status, Equals, statusFailed)
+	c.Assert(result.Error, NotNil)
+	c.Assert(result.Error.Migration, Equals, "2_broken.sql")
+	c.Assert(*result.Error.StatementIndex, Equals, 1)
+	c.Assert(result.Error.Line, Equals, 3)
+	c.Assert(result.Error.Statement, Equals, "SELECT * FROM nope;")
+}
+
+func (s *OutputSuite) TestStatusCheck(c *C) {
+	args := []string{"-config", ConfigFile, "-env", ConfigEnvironment, "-output", "json", "-check"}
+	code := (&StatusCommand{}).Run(args)
+	c.Assert(code, Equals, exitFailure)
+
+	var result statusOutput
+	c.Assert(json.Unmarshal(s.out.Bytes(), &result), IsNil)
+	c.Assert(result.Migrations, HasLen, 1)
+	c.Assert(result.Error, NotNil)
+	c.Assert(result.Error.Message, Equals, "1_people.sql: migration has not been applied")
+	s.out.Reset()
+
+	_, err := ApplyMigrations(migrate.Up, false, 0, -1)
+	c.Assert(err, IsNil)
+	s.out.Reset()
+	code = (&StatusCommand{}).Run(args)
+	c.Assert(code, Equals, exitSuccess)
+	result = statusOutput{}
+	c.Assert(json.Unmarshal(s.out.Bytes(), &result), IsNil)
+	c.Assert(result.Error, IsNil)
+}
+
+func (*OutputSuite) TestOutputFormat(c *C) {
+	cmdFlags := flag.NewFlagSet("test", flag.ContinueOnError)
+	cmdFlags.SetOutput(io.Discard)
+	OutputFlags(cmdFlags)
+	c.Assert(cmdFlags.Parse([]string{"-output", "yaml"}), IsNil)
+	c.Assert(OutputFormat, Equals, outputYAML)
+	c.Assert(cmdFlags.Parse([]string{"-output", "github"}), ErrorMatches, `.*Unknown output format: github \(use text, json or yaml\)`)
+
+	cmdFlags = flag.NewFlagSet("lint", flag.ContinueOnError)
+	OutputFlags(cmdFlags, outputGithub)
+	c.Assert(cmdFlags.Parse([]string{"-output", "github"}), IsNil)
+	c.Assert(OutputFormat, Equals, outputGithub)
+	c.Assert(OutputFormat.structured(), Equals, false)
+	c.Assert(cmdFlags.Lookup("output").Usage, Equals, "Output format: text, json, yaml or github.")
+}
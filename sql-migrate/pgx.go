@@ -0,0 +1,13 @@
+//go:build pgx
+// +build pgx
+
+// pgx is a pure Go postgres driver
+// repo: https://github.com/jackc/pgx
+//
+// It uses the postgres dialect, select it with `driver: pgx` or
+// `dialect: pgx` in the configuration file.
+package main
+
+import (
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+// AssumeYes skips the confirmation of environments with require_confirmation.
+var AssumeYes bool
+
+func PolicyFlags(f *flag.FlagSet) {
+	f.BoolVar(&AssumeYes, "yes", false, "Don't ask for confirmation.")
+}
+
+// Applies the defaults of the safety policies of an environment. Protected
+// environments don't allow migrating down and require confirmation, unless
+// configured otherwise.
+func applyPolicyDefaults(env *Environment) error {
+	if env.AllowDown == nil {
+		allowDown := !env.Protected
+		env.AllowDown = &allowDown
+	}
+	if env.RequireConfirmation == nil {
+		requireConfirmation := env.Protected
+		env.RequireConfirmation = &requireConfirmation
+	}
+	if env.MaxMigrationsPerRun < 0 {
+		return fmt.Errorf("Invalid max_migrations_per_run: %d", env.MaxMigrationsPerRun)
+	}
+	return nil
+}
+
+// Checks that count migrations may be run in the given direction in the
+// environment, and asks for confirmation when the environment requires it.
+// Nothing is asked for dry runs or when there's nothing to do.
+func checkPolicy(env *Environment, dir migrate.MigrationDirection, count int, dryrun bool) error {
+	if count == 0 {
+		return nil
+	}
+
+	if dir == migrate.Down && !*env.AllowDown {
+		return fmt.Errorf("Migrating down is not allowed in environment %s (see allow_down)", ConfigEnvironment)
+	}
+
+	if env.MaxMigrationsPerRun > 0 && count > env.MaxMigrationsPerRun {
+		return fmt.Errorf("Refusing to run %d migrations, environment %s allows at most %d per run (use -limit)",
+			count, ConfigEnvironment, env.MaxMigrationsPerRun)
+	}
+
+	if dryrun || !*env.RequireConfirmation || AssumeYes {
+		return nil
+	}
+	return confirm()
+}
+
+// Asks to type the name of the environment before migrating it.
+func confirm() error {
+	refused := fmt.Errorf("Environment %s requires confirmation, use -yes to run without asking", ConfigEnvironment)
+
+	// The question would end up in the document.
+	if OutputFormat.structured() {
+		return refused
+	}
+
+	answer, err := ui.Ask(fmt.Sprintf("You are about to migrate the %s environment. Type its name to continue:", ConfigEnvironment))
+	if err != nil {
+		return refused
+	}
+	if strings.TrimSpace(answer) != ConfigEnvironment {
+		return errors.New("Aborted: the environment name did not match")
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mitchellh/cli"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+type PolicySuite struct {
+	dir string
+	out *bytes.Buffer
+}
+
+var _ = Suite(&PolicySuite{})
+
+func (s *PolicySuite) SetUpTest(c *C) {
+	s.dir = c.MkDir()
+	c.Assert(os.Mkdir(filepath.Join(s.dir, "migrations"), 0o700), IsNil)
+	for _, name := range []string{"1_people.sql", "2_pets.sql", "3_cars.sql"} {
+		c.Assert(os.WriteFile(filepath.Join(s.dir, "migrations", name),
+			[]byte("-- +migrate Up\nSELECT 1;\n-- +migrate Down\nSELECT 2;\n"), 0o600), IsNil)
+	}
+
+	ConfigFile = filepath.Join(s.dir, "dbconfig.yml")
+	ConfigEnvironment = "production"
+	s.out = &bytes.Buffer{}
+	ui = &cli.BasicUi{Reader: strings.NewReader(""), Writer: s.out, ErrorWriter: s.out}
+}
+
+func (*PolicySuite) TearDownTest(*C) {
+	AssumeYes = false
+}
+
+func (s *PolicySuite) writeConfig(c *C, policies string) {
+	config := "production:\n  dialect: sqlite3\n  datasource: " + filepath.Join(s.dir, "test.db") +
+		"\n  dir: " + filepath.Join(s.dir, "migrations") + "\n" + policies
+	c.Assert(os.WriteFile(ConfigFile, []byte(config), 0o600), IsNil)
+}
+
+func (s *PolicySuite) TestDefaults(c *C) {
+	s.writeConfig(c, "")
+	env, err := GetEnvironment()
+	c.Assert(err, IsNil)
+	c.Assert(*env.AllowDown, Equals, true)
+	c.Assert(*env.RequireConfirmation, Equals, false)
+
+	s.writeConfig(c, "  protected: true\n")
+	env, err = GetEnvironment()
+	c.Assert(err, IsNil)
+	c.Assert(*env.AllowDown, Equals, false)
+	c.Assert(*env.RequireConfirmation, Equals, true)
+
+	s.writeConfig(c, "  protected: true\n  allow_down: true\n")
+	env, err = GetEnvironment()
+	c.Assert(err, IsNil)
+	c.Assert(*env.AllowDown, Equals, true)
+	c.Assert(*env.RequireConfirmation, Equals, true)
+
+	s.writeConfig(c, "  max_migrations_per_run: -1\n")
+	_, err = GetEnvironment()
+	c.Assert(err, ErrorMatches, "Invalid max_migrations_per_run: -1")
+}
+
+func (s *PolicySuite) TestMaxMigrationsPerRun(c *C) {
+	s.writeConfig(c, "  max_migrations_per_run: 2\n")
+
+	_, err := ApplyMigrations(migrate.Up, true, 0, -1)
+	c.Assert(err, ErrorMatches, `Refusing to run 3 migrations, environment production allows at most 2 per run \(use -limit\)`)
+
+	_, err = ApplyMigrations(migrate.Up, false, 2, -1)
+	c.Assert(err, IsNil)
+}
+
+func (s *PolicySuite) TestAllowDown(c *C) {
+	s.writeConfig(c, "  allow_down: false\n")
+
+	_, err := ApplyMigrations(migrate.Up, false, 0, -1)
+	c.Assert(err, IsNil)
+
+	_, err = ApplyMigrations(migrate.Down, false, 1, -1)
+	c.Assert(err, ErrorMatches, `Migrating down is not allowed in environment production \(see allow_down\)`)
+	_, err = RedoMigration(false)
+	c.Assert(err, ErrorMatches, "Migrating down is not allowed .*")
+	_, err = GotoMigration("1_people.sql", false)
+	c.Assert(err, ErrorMatches, "Migrating down is not allowed .*")
+
+	// Nothing to migrate up isn't refused.
+	_, err = GotoMigration("3_cars.sql", false)
+	c.Assert(err, IsNil)
+}
+
+func (s *PolicySuite) TestRequireConfirmation(c *C) {
+	s.writeConfig(c, "  require_confirmation: true\n")
+
+	_, err := ApplyMigrations(migrate.Up, false, 1, -1)
+	c.Assert(err, ErrorMatches, "Environment production requires confirmation, use -yes to run without asking")
+
+	ui.(*cli.BasicUi).Reader = strings.NewReader("staging\n")
+	_, err = ApplyMigrations(migrate.Up, false, 1, -1)
+	c.Assert(err, ErrorMatches, "Aborted: the environment name did not match")
+
+	ui.(*cli.BasicUi).Reader = strings.NewReader("production\n")
+	_, err = ApplyMigrations(migrate.Up, false, 1, -1)
+	c.Assert(err, IsNil)
+	c.Assert(s.out.String(), Matches, "(?s).*Type its name to continue.*")
+
+	// Dry runs don't ask.
+	_, err = ApplyMigrations(migrate.Up, true, 0, -1)
+	c.Assert(err, IsNil)
+
+	AssumeYes = true
+	_, err = SkipMigrations(migrate.Up, 0)
+	c.Assert(err, IsNil)
+}
+
+func (s *PolicySuite) TestPlannedOnce(c *C) {
+	s.writeConfig(c, "  emptydown: warn\n")
+	c.Assert(os.WriteFile(filepath.Join(s.dir, "migrations", "2_pets.sql"),
+		[]byte("-- +migrate Up\nSELECT 1;\n-- +migrate Down\n"), 0o600), IsNil)
+	warning := "2_pets.sql: migration has no Down statements"
+
+	_, err := ApplyMigrations(migrate.Up, false, 0, -1)
+	c.Assert(err, IsNil)
+	s.out.Reset()
+
+	// The migrations are planned once, so the warning is printed once.
+	_, err = ApplyMigrations(migrate.Down, false, 2, -1)
+	c.Assert(err, IsNil)
+	c.Assert(strings.Count(s.out.String(), warning), Equals, 1)
+
+	_, err = ApplyMigrations(migrate.Up, false, 0, -1)
+	c.Assert(err, IsNil)
+	s.out.Reset()
+	_, err = GotoMigration("1_people.sql", false)
+	c.Assert(err, IsNil)
+	c.Assert(strings.Count(s.out.String(), warning), Equals, 1)
+}
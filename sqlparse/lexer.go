@@ -0,0 +1,205 @@
+package sqlparse
+
+import (
+	"fmt"
+	"strings"
+)
+
+type lexerState int
+
+const (
+	stateCode lexerState = iota
+	stateSingleQuote
+	stateDoubleQuote
+	stateBacktick
+	stateDollarQuote
+	stateBlockComment
+)
+
+// lexer follows quotes and comments through the lines of a statement, so
+// semicolons inside them don't end the statement.
+type lexer struct {
+	state lexerState
+
+	// escapes is set inside an E'...' string, where a backslash escapes the
+	// next character.
+	escapes bool
+
+	// backslashEscapes makes a backslash escape the next character in every
+	// quoted string and # start a line comment, like MySQL does, see
+	// ParseOptions.BackslashEscapes.
+	backslashEscapes bool
+
+	// tag is the tag of the dollar quote, eg: $body$ or $$.
+	tag string
+
+	// depth is the nesting level of block comments.
+	depth int
+
+	// terminated is set when the last token outside of quotes and comments
+	// is the delimiter, which can be followed by a comment on the next lines.
+	terminated bool
+
+	// delimiter replaces the semicolon when set, like the DELIMITER command
+	// of the mysql client does.
+	delimiter string
+
+	// delimiterAt is the offset of the delimiter that terminates the
+	// statement in the last line, -1 when it's not in the last line.
+	delimiterAt int
+}
+
+// Prepares the lexer for the next statement.
+func (l *lexer) reset() {
+	*l = lexer{delimiter: l.delimiter, backslashEscapes: l.backslashEscapes}
+}
+
+// Returns what the lexer is in the middle of, for error messages.
+func (l *lexer) describe() string {
+	switch l.state {
+	case stateSingleQuote:
+		return "string literal"
+	case stateDoubleQuote:
+		return "quoted identifier"
+	case stateBacktick:
+		return "backtick quoted identifier"
+	case stateDollarQuote:
+		return fmt.Sprintf("dollar quoted string %s", l.tag)
+	case stateBlockComment:
+		return "block comment"
+	default:
+		return ""
+	}
+}
+
+// scanLine feeds the next line of a statement to the lexer, and returns
+// whether the line ends the statement: the last token outside of quotes and
+// comments is a semicolon, or the delimiter when one is set.
+func (l *lexer) scanLine(line string) bool {
+	l.delimiterAt = -1
+
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+
+		switch l.state {
+		case stateCode:
+			switch {
+			case l.delimiter != "" && strings.HasPrefix(line[i:], l.delimiter):
+				l.terminated = true
+				l.delimiterAt = i
+				i += len(l.delimiter) - 1
+
+			case ch == '-' && next(line, i) == '-':
+				return l.terminated
+
+			case ch == '#' && l.backslashEscapes:
+				return l.terminated
+
+			case ch == '/' && next(line, i) == '*':
+				l.state = stateBlockComment
+				l.depth = 1
+				i++
+
+			case ch == '\'':
+				l.state = stateSingleQuote
+				l.escapes = l.backslashEscapes || i > 0 && (line[i-1] == 'E' || line[i-1] == 'e') && (i == 1 || !isIdentChar(line[i-2]))
+				l.terminated = false
+
+			case ch == '"':
+				l.state = stateDoubleQuote
+				l.terminated = false
+
+			case ch == '`':
+				l.state = stateBacktick
+				l.terminated = false
+
+			case ch == '$' && (i == 0 || !isIdentChar(line[i-1])):
+				if tag := dollarTag(line[i:]); tag != "" {
+					l.state = stateDollarQuote
+					l.tag = tag
+					i += len(tag) - 1
+				}
+				l.terminated = false
+
+			case ch == ';' && l.delimiter == "":
+				l.terminated = true
+
+			case ch != ' ' && ch != '\t' && ch != '\r':
+				l.terminated = false
+				l.delimiterAt = -1
+			}
+
+		case stateSingleQuote:
+			switch {
+			case ch == '\\' && l.escapes:
+				i++
+			case ch == '\'':
+				// A doubled quote reopens the string on the next character.
+				l.state = stateCode
+			}
+
+		case stateDoubleQuote:
+			switch {
+			case ch == '\\' && l.backslashEscapes:
+				i++
+			case ch == '"':
+				l.state = stateCode
+			}
+
+		case stateBacktick:
+			if ch == '`' {
+				l.state = stateCode
+			}
+
+		case stateDollarQuote:
+			if ch == '$' && len(line)-i >= len(l.tag) && line[i:i+len(l.tag)] == l.tag {
+				l.state = stateCode
+				i += len(l.tag) - 1
+				l.tag = ""
+			}
+
+		case stateBlockComment:
+			switch {
+			case ch == '/' && next(line, i) == '*':
+				l.depth++
+				i++
+			case ch == '*' && next(line, i) == '/':
+				l.depth--
+				i++
+				if l.depth == 0 {
+					l.state = stateCode
+				}
+			}
+		}
+	}
+
+	return l.terminated && l.state == stateCode
+}
+
+func next(line string, i int) byte {
+	if i+1 < len(line) {
+		return line[i+1]
+	}
+	return 0
+}
+
+func isIdentChar(ch byte) bool {
+	return ch == '_' || ch == '$' || ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z') || ('0' <= ch && ch <= '9')
+}
+
+// Returns the dollar quote tag s starts with, eg: $$ or $body$, or "" when s
+// doesn't start with one, like a $1 parameter.
+func dollarTag(s string) string {
+	for i := 1; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch == '$':
+			return s[:i+1]
+		case ch == '_' || ('a' <= ch && ch <= 'z') || ('A' <= ch && ch <= 'Z'):
+		case '0' <= ch && ch <= '9' && i > 1:
+		default:
+			return ""
+		}
+	}
+	return ""
+}
@@ -3,50 +3,216 @@ package sqlparse
 import (
 	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"iter"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+
+	"github.com/rubenv/sql-migrate/internal/errs"
 )
 
 const (
 	sqlCmdPrefix        = "-- +migrate "
 	optionNoTransaction = "notransaction"
+	optionIrreversible  = "irreversible"
+	optionLintIgnore    = "ignore="
+)
+
+// StatementPosition is where a statement is in the migration file.
+type StatementPosition struct {
+	// StartLine and EndLine are the first and last line of the statement,
+	// counting from 1.
+	StartLine int
+	EndLine   int
+}
+
+// Errors returned by ParseMigration, which can be matched with errors.Is.
+var (
+	// ErrNoTerminator means the last statement of a section isn't ended.
+	ErrNoTerminator = errors.New("statement not terminated")
+
+	// ErrNoAnnotations means the migration has no Up or Down annotation.
+	ErrNoAnnotations = errors.New("no Up/Down annotations found")
+
+	// ErrUnterminated means a string literal, quoted identifier or block
+	// comment isn't closed.
+	ErrUnterminated = errors.New("unterminated quote or comment")
+
+	// ErrUnmatchedStatementBegin means a StatementBegin annotation has no
+	// StatementEnd.
+	ErrUnmatchedStatementBegin = errors.New("StatementBegin without StatementEnd")
+
+	// ErrInvalidAnnotation means an annotation is missing or has wrong
+	// options.
+	ErrInvalidAnnotation = errors.New("invalid annotation")
+
+	// ErrInclude means a file can't be included.
+	ErrInclude = errors.New("can't include file")
 )
 
 type ParsedMigration struct {
 	UpStatements   []string
 	DownStatements []string
 
+	// UpPositions and DownPositions hold the position of each statement in
+	// UpStatements and DownStatements.
+	UpPositions   []StatementPosition
+	DownPositions []StatementPosition
+
+	// UpBlocks and DownBlocks tell for each statement in UpStatements and
+	// DownStatements whether it's a PL/SQL block, see Statement.Block.
+	UpBlocks   []bool
+	DownBlocks []bool
+
 	DisableTransactionUp   bool
 	DisableTransactionDown bool
+
+	// Squashes lists the Ids of the migrations this migration replaces.
+	Squashes []string
+
+	// HasDown is set when the migration has a Down section, even if it holds
+	// no statements.
+	HasDown bool
+
+	// LintIgnore lists the lint rules that are suppressed for this migration,
+	// from "-- +migrate Lint ignore=<rule>[,<rule>...]" annotations.
+	LintIgnore []string
+
+	// Irreversible is set by a "-- +migrate Down irreversible" annotation,
+	// for migrations that can't be undone. Their Down section can't have
+	// statements.
+	Irreversible bool
 }
 
+// LegacyStatementSplitting makes ParseMigration split statements like older
+// versions did: a statement ends at a line whose last word ends with a
+// semicolon, even when that semicolon is inside a string literal, quoted
+// identifier or comment spanning several lines.
+//
+// Deprecated: Use ParseOptions.LegacyStatementSplitting, which doesn't affect
+// other parses in the process.
+var LegacyStatementSplitting = false
+
 // LineSeparator can be used to split migrations by an exact line match. This line
 // will be removed from the output. If left blank, it is not considered. It is defaulted
 // to blank so you will have to set it manually.
 // Use case: in MSSQL, it is convenient to separate commands by GO statements like in
 // SQL Query Analyzer.
+//
+// Deprecated: Use ParseOptions.Separator or a "-- +migrate Separator" annotation,
+// which don't affect other parses in the process.
 var LineSeparator = ""
 
-func errNoTerminator() error {
-	if len(LineSeparator) == 0 {
-		return fmt.Errorf(`ERROR: The last statement must be ended by a semicolon or '-- +migrate StatementEnd' marker.
+// ParseOptions configures how ParseMigrationWithOptions splits statements.
+type ParseOptions struct {
+	// Separator splits statements by an exact line match, eg: GO for SQL
+	// Server, like LineSeparator. The line is removed from the output. A
+	// "-- +migrate Separator" annotation overrides it for a single file.
+	//
+	// With GO, a "GO <count>" line runs the statement count times. With /,
+	// PL/SQL blocks are only ended by the / line, like in SQL*Plus.
+	Separator string
+
+	// LegacyStatementSplitting splits statements like older versions did,
+	// see the LegacyStatementSplitting variable.
+	LegacyStatementSplitting bool
+
+	// BackslashEscapes makes a backslash escape the next character in all
+	// quoted strings, eg: 'it\'s', like MySQL does unless the
+	// NO_BACKSLASH_ESCAPES mode is set. Otherwise backslashes only escape in
+	// PostgreSQL E'...' strings. It also makes # start a comment to the end
+	// of the line, like in MySQL.
+	BackslashEscapes bool
+
+	// Include reads the file named by a "-- +migrate Include" annotation,
+	// whose lines replace the annotation. The name is a slash separated path,
+	// cleaned with path.Clean. Includes are an error when nil.
+	Include func(name string) ([]byte, error)
+}
+
+// An included file being read, see ParseOptions.Include.
+type includedFile struct {
+	name   string
+	reader *bufio.Reader
+}
+
+// Returns the next line without its line ending, like bufio.ScanLines, but
+// without a limit on its length. Returns false at the end of the input.
+func readLine(r *bufio.Reader) (string, bool, error) {
+	line, err := r.ReadString('\n')
+	switch {
+	case err == io.EOF && line == "":
+		return "", false, nil
+	case err != nil && err != io.EOF:
+		return "", false, err
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+	return strings.TrimSuffix(line, "\r"), true, nil
+}
+
+// DefaultParseOptions returns the options ParseMigration uses, from the
+// LineSeparator and LegacyStatementSplitting variables.
+func DefaultParseOptions() ParseOptions {
+	return ParseOptions{
+		Separator:                LineSeparator,
+		LegacyStatementSplitting: LegacyStatementSplitting,
+	}
+}
+
+// delimiterRegex matches the DELIMITER command of the mysql client, which
+// changes what ends a statement, eg: "DELIMITER $$" until "DELIMITER ;".
+var delimiterRegex = regexp.MustCompile(`(?i)^\s*DELIMITER\s+(\S+)\s*$`)
+
+// plsqlBlockRegex matches the start of a PL/SQL block, which can contain
+// semicolons and is ended by a / line.
+var plsqlBlockRegex = regexp.MustCompile(`(?i)^\s*(DECLARE|BEGIN|CREATE\s+(OR\s+REPLACE\s+)?((NON)?EDITIONABLE\s+)?(FUNCTION|PROCEDURE|PACKAGE|TRIGGER|TYPE|LIBRARY))\b`)
+
+func errNoTerminator(separator string) error {
+	if len(separator) == 0 {
+		return errs.Mark(ErrNoTerminator, `ERROR: The last statement must be ended by a semicolon or '-- +migrate StatementEnd' marker.
 			See https://github.com/rubenv/sql-migrate for details.`)
 	}
 
-	return fmt.Errorf(`ERROR: The last statement must be ended by a semicolon, a line whose contents are %q, or '-- +migrate StatementEnd' marker.
-			See https://github.com/rubenv/sql-migrate for details.`, LineSeparator)
+	return errs.Mark(ErrNoTerminator, `ERROR: The last statement must be ended by a semicolon, a line whose contents are %q, or '-- +migrate StatementEnd' marker.
+			See https://github.com/rubenv/sql-migrate for details.`, separator)
+}
+
+// Returns how many times the statement before the line runs when the line is
+// the separator: 1, or the count of a "GO <count>" line. Returns 0 when the
+// line isn't the separator.
+func separatorCount(line, separator string) int {
+	if len(separator) == 0 {
+		return 0
+	}
+	if line == separator {
+		return 1
+	}
+	if !strings.EqualFold(separator, "GO") {
+		return 0
+	}
+
+	rest, ok := strings.CutPrefix(line, separator)
+	if !ok || !strings.HasPrefix(rest, " ") {
+		return 0
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(rest))
+	if err != nil || count < 1 {
+		return 0
+	}
+	return count
 }
 
 // Checks the line to see if the line has a statement-ending semicolon
 // or if the line contains a double-dash comment.
 func endsWithSemicolon(line string) bool {
 	prev := ""
-	scanner := bufio.NewScanner(strings.NewReader(line))
-	scanner.Split(bufio.ScanWords)
-
-	for scanner.Scan() {
-		word := scanner.Text()
+	for _, word := range strings.Fields(line) {
 		if strings.HasPrefix(word, "--") {
 			break
 		}
@@ -83,12 +249,12 @@ func parseCommand(line string) (*migrateCommand, error) {
 	cmd := &migrateCommand{}
 
 	if !strings.HasPrefix(line, sqlCmdPrefix) {
-		return nil, fmt.Errorf("ERROR: not a sql-migrate command")
+		return nil, errs.Mark(ErrInvalidAnnotation, "ERROR: not a sql-migrate command")
 	}
 
 	fields := strings.Fields(line[len(sqlCmdPrefix):])
 	if len(fields) == 0 {
-		return nil, fmt.Errorf(`ERROR: incomplete migration command`)
+		return nil, errs.Mark(ErrInvalidAnnotation, `ERROR: incomplete migration command`)
 	}
 
 	cmd.Command = fields[0]
@@ -107,7 +273,16 @@ func parseCommand(line string) (*migrateCommand, error) {
 // within a statement. For these cases, we provide the explicit annotations
 // 'StatementBegin' and 'StatementEnd' to allow the script to
 // tell us to ignore semicolons.
+//
+// ParseMigration uses the LineSeparator and LegacyStatementSplitting
+// variables, use ParseMigrationWithOptions to set them for a single parse.
 func ParseMigration(r io.ReadSeeker) (*ParsedMigration, error) {
+	return ParseMigrationWithOptions(r, DefaultParseOptions())
+}
+
+// ParseMigrationWithOptions splits the given sql script into individual
+// statements like ParseMigration, using the given options.
+func ParseMigrationWithOptions(r io.ReadSeeker, options ParseOptions) (*ParsedMigration, error) {
 	p := &ParsedMigration{}
 
 	_, err := r.Seek(0, 0)
@@ -115,18 +290,111 @@ func ParseMigration(r io.ReadSeeker) (*ParsedMigration, error) {
 		return nil, err
 	}
 
+	err = parse(r, options, p, func(stmt Statement) bool {
+		if stmt.Down {
+			p.DownStatements = append(p.DownStatements, stmt.SQL)
+			p.DownPositions = append(p.DownPositions, stmt.Position)
+			p.DownBlocks = append(p.DownBlocks, stmt.Block)
+		} else {
+			p.UpStatements = append(p.UpStatements, stmt.SQL)
+			p.UpPositions = append(p.UpPositions, stmt.Position)
+			p.UpBlocks = append(p.UpBlocks, stmt.Block)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Statement is a statement of a migration, see StreamMigration.
+type Statement struct {
+	SQL      string
+	Position StatementPosition
+
+	// Down is set for the statements of the Down section.
+	Down bool
+
+	// Block is set for a PL/SQL block ended by a / separator. Its final
+	// semicolon is part of the block, so it must be executed as is.
+	Block bool
+
+	// DisableTransaction is set when the section of the statement has the
+	// notransaction option.
+	DisableTransaction bool
+}
+
+// StreamMigration splits the given sql script into statements like
+// ParseMigrationWithOptions, but returns them as they're parsed, so a
+// migration doesn't have to fit in memory, and there's no limit on the
+// length of its lines.
+//
+// The returned ParsedMigration is filled in while the statements are read,
+// except for UpStatements, DownStatements and their positions. Iterating stops
+// at the first error.
+func StreamMigration(r io.Reader, options ParseOptions) (*ParsedMigration, iter.Seq2[Statement, error]) {
+	p := &ParsedMigration{}
+	return p, func(yield func(Statement, error) bool) {
+		stopped := false
+		err := parse(r, options, p, func(stmt Statement) bool {
+			stopped = !yield(stmt, nil)
+			return !stopped
+		})
+		if err != nil && !stopped {
+			yield(Statement{}, err)
+		}
+	}
+}
+
+// Splits the sql script into statements, which are passed to yield until it
+// returns false. Everything else that's parsed is stored in p.
+func parse(r io.Reader, options ParseOptions, p *ParsedMigration, yield func(Statement) bool) error {
+	separator := options.Separator
+
 	var buf bytes.Buffer
-	scanner := bufio.NewScanner(r)
-	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	// files holds the migration and the files it's including, the innermost
+	// one last.
+	files := []*includedFile{{reader: bufio.NewReader(r)}}
 
 	statementEnded := false
 	ignoreSemicolons := false
 	currentDirection := directionNone
+	plsqlBlock := false
+
+	// last is the last statement, until a line follows it. A "GO <count>"
+	// right after a statement ended by a semicolon repeats it.
+	var last *Statement
+	lex := lexer{backslashEscapes: options.BackslashEscapes}
+
+	// delimiterAt is the offset in buf of the delimiter that ended the
+	// statement, -1 when it wasn't ended by a DELIMITER delimiter.
+	delimiterAt := -1
+
+	// lineNumber is the number of the current line, position the lines of
+	// the statement in buf that aren't blank. Lines of included files count
+	// as the line of their Include annotation.
+	lineNumber := 0
+	var position StatementPosition
+
+	for len(files) > 0 {
+		line, ok, err := readLine(files[len(files)-1].reader)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			files = files[:len(files)-1]
+			continue
+		}
 
-	for scanner.Scan() {
-		line := scanner.Text()
-		// ignore comment except beginning with '-- +'
-		if strings.HasPrefix(line, "-- ") && !strings.HasPrefix(line, "-- +") {
+		if len(files) == 1 {
+			lineNumber++
+		}
+
+		// ignore comment except beginning with '-- +', unless it's part of
+		// a string
+		if strings.HasPrefix(line, "-- ") && !strings.HasPrefix(line, "-- +") && lex.state == stateCode {
 			continue
 		}
 
@@ -134,27 +402,35 @@ func ParseMigration(r io.ReadSeeker) (*ParsedMigration, error) {
 		if strings.HasPrefix(line, sqlCmdPrefix) {
 			cmd, err := parseCommand(line)
 			if err != nil {
-				return nil, err
+				return err
 			}
 
 			switch cmd.Command {
 			case "Up":
-				if len(strings.TrimSpace(buf.String())) > 0 {
-					return nil, errNoTerminator()
+				if position.StartLine > 0 {
+					return errNoTerminator(separator)
 				}
 				currentDirection = directionUp
+				lex.delimiter = ""
+				last = nil
 				if cmd.HasOption(optionNoTransaction) {
 					p.DisableTransactionUp = true
 				}
 
 			case "Down":
-				if len(strings.TrimSpace(buf.String())) > 0 {
-					return nil, errNoTerminator()
+				if position.StartLine > 0 {
+					return errNoTerminator(separator)
 				}
 				currentDirection = directionDown
+				lex.delimiter = ""
+				last = nil
+				p.HasDown = true
 				if cmd.HasOption(optionNoTransaction) {
 					p.DisableTransactionDown = true
 				}
+				if cmd.HasOption(optionIrreversible) {
+					p.Irreversible = true
+				}
 
 			case "StatementBegin":
 				if currentDirection != directionNone {
@@ -166,6 +442,39 @@ func ParseMigration(r io.ReadSeeker) (*ParsedMigration, error) {
 					statementEnded = ignoreSemicolons
 					ignoreSemicolons = false
 				}
+
+			case "Separator":
+				if len(cmd.Options) != 1 {
+					return errs.Mark(ErrInvalidAnnotation, "ERROR: '-- +migrate Separator' needs a single line to separate statements by")
+				}
+				separator = cmd.Options[0]
+
+			case "Include":
+				if len(cmd.Options) != 1 {
+					return errs.Mark(ErrInvalidAnnotation, "ERROR: '-- +migrate Include' needs a single file to include")
+				}
+				included, err := include(options, files, cmd.Options[0])
+				if err != nil {
+					return err
+				}
+				files = append(files, included)
+				continue
+
+			case "Squashes":
+				p.Squashes = append(p.Squashes, cmd.Options...)
+
+			case "Lint":
+				for _, opt := range cmd.Options {
+					rules, ok := strings.CutPrefix(opt, optionLintIgnore)
+					if !ok {
+						return errs.Mark(ErrInvalidAnnotation, "ERROR: unknown Lint option %q", opt)
+					}
+					names := strings.Split(rules, ",")
+					if slices.Contains(names, "") {
+						return errs.Mark(ErrInvalidAnnotation, "ERROR: missing rule name in Lint option %q", opt)
+					}
+					p.LintIgnore = append(p.LintIgnore, names...)
+				}
 			}
 		}
 
@@ -173,54 +482,259 @@ func ParseMigration(r io.ReadSeeker) (*ParsedMigration, error) {
 			continue
 		}
 
-		isLineSeparator := !ignoreSemicolons && len(LineSeparator) > 0 && line == LineSeparator
+		// DELIMITER is interpreted by the mysql client, the server doesn't
+		// know it, so it's left out of the statements.
+		if m := delimiterRegex.FindStringSubmatch(line); m != nil && !options.LegacyStatementSplitting && lex.state == stateCode {
+			if position.StartLine > 0 {
+				return errNoTerminator(separator)
+			}
+			lex.delimiter = m[1]
+			if lex.delimiter == ";" {
+				lex.delimiter = ""
+			}
+			continue
+		}
+
+		repeat := 0
+		if !ignoreSemicolons && lex.state == stateCode {
+			repeat = separatorCount(line, separator)
+		}
+		isLineSeparator := repeat > 0
+
+		// Like SQL*Plus, a PL/SQL block is only ended by the / line.
+		if separator == "/" && position.StartLine == 0 && plsqlBlockRegex.MatchString(line) {
+			plsqlBlock = true
+		}
+
+		var endsStatement bool
+		if options.LegacyStatementSplitting {
+			endsStatement = endsWithSemicolon(line)
+		} else if !strings.HasPrefix(line, "-- +") {
+			endsStatement = lex.scanLine(line)
+			if lex.delimiterAt >= 0 {
+				delimiterAt = buf.Len() + lex.delimiterAt
+			} else if lex.state != stateCode || !lex.terminated {
+				delimiterAt = -1
+			}
+		}
 
 		if !isLineSeparator && !strings.HasPrefix(line, "-- +") {
 			if _, err := buf.WriteString(line + "\n"); err != nil {
-				return nil, err
+				return err
+			}
+			if strings.TrimSpace(line) != "" {
+				if position.StartLine == 0 {
+					position.StartLine = lineNumber
+				}
+				position.EndLine = lineNumber
 			}
 		}
 
 		// Wrap up the two supported cases: 1) basic with semicolon; 2) psql statement
 		// Lines that end with semicolon that are in a statement block
 		// do not conclude statement.
-		if (!ignoreSemicolons && (endsWithSemicolon(line) || isLineSeparator)) || statementEnded {
+		if plsqlBlock && !isLineSeparator {
+			endsStatement = false
+		}
+
+		// A separator after a statement ended by a semicolon doesn't start
+		// another one, eg: a / after a plain SQL statement in SQL*Plus. A
+		// "GO <count>" still runs that statement count times.
+		if isLineSeparator && position.StartLine == 0 {
+			buf.Reset()
+			if last != nil {
+				for i := 1; i < repeat; i++ {
+					if !yield(*last) {
+						return nil
+					}
+				}
+			}
+			last = nil
+			continue
+		}
+
+		if (!ignoreSemicolons && (endsStatement || isLineSeparator)) || statementEnded {
+			block := plsqlBlock && isLineSeparator
 			statementEnded = false
+			plsqlBlock = false
+			statement := buf.String()
+			if lex.delimiter != "" && delimiterAt >= 0 {
+				// The delimiter isn't SQL, strip it like the mysql client.
+				statement = strings.TrimRight(statement[:delimiterAt], " \t\r") + "\n"
+			}
+			delimiterAt = -1
+			lex.reset()
+			if position.StartLine == 0 {
+				position = StatementPosition{StartLine: lineNumber, EndLine: lineNumber}
+			}
+			stmt := Statement{SQL: statement, Position: position, Block: block}
 			switch currentDirection {
 			case directionUp:
-				p.UpStatements = append(p.UpStatements, buf.String())
+				stmt.DisableTransaction = p.DisableTransactionUp
 
 			case directionDown:
-				p.DownStatements = append(p.DownStatements, buf.String())
+				if p.Irreversible {
+					return errs.Mark(ErrInvalidAnnotation, "ERROR: the Down section of an irreversible migration can't have statements (line %d)", position.StartLine)
+				}
+				stmt.Down = true
+				stmt.DisableTransaction = p.DisableTransactionDown
 
 			default:
 				panic("impossible state")
 			}
+			for i := 0; i < max(repeat, 1); i++ {
+				if !yield(stmt) {
+					return nil
+				}
+			}
+			last = &stmt
+			if isLineSeparator {
+				// The separator was used up by this statement.
+				last = nil
+			}
+			position = StatementPosition{}
 
 			buf.Reset()
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+	// diagnose likely migration script errors
+	if lex.state != stateCode {
+		return errs.Mark(ErrUnterminated, "ERROR: unterminated %s", lex.describe())
 	}
 
-	// diagnose likely migration script errors
 	if ignoreSemicolons {
-		return nil, fmt.Errorf("ERROR: saw '-- +migrate StatementBegin' with no matching '-- +migrate StatementEnd'")
+		return errs.Mark(ErrUnmatchedStatementBegin, "ERROR: saw '-- +migrate StatementBegin' with no matching '-- +migrate StatementEnd'")
 	}
 
 	if currentDirection == directionNone {
-		return nil, fmt.Errorf(`ERROR: no Up/Down annotations found, so no statements were executed.
+		return errs.Mark(ErrNoAnnotations, `ERROR: no Up/Down annotations found, so no statements were executed.
 			See https://github.com/rubenv/sql-migrate for details.`)
 	}
 
 	// allow comment without sql instruction. Example:
 	// -- +migrate Down
 	// -- nothing to downgrade!
-	if len(strings.TrimSpace(buf.String())) > 0 && !strings.HasPrefix(buf.String(), "-- +") {
-		return nil, errNoTerminator()
+	if position.StartLine > 0 {
+		return errNoTerminator(separator)
 	}
 
-	return p, nil
+	return nil
+}
+
+// Opens the file named by an Include annotation in the innermost of files,
+// the files being read.
+func include(options ParseOptions, files []*includedFile, name string) (*includedFile, error) {
+	if options.Include == nil {
+		return nil, errs.Mark(ErrInclude, "ERROR: can't include %s, includes aren't supported here", name)
+	}
+	name = path.Clean(name)
+
+	for i, file := range files {
+		if file.name != name {
+			continue
+		}
+		var cycle []string
+		for _, f := range files[i:] {
+			cycle = append(cycle, f.name)
+		}
+		return nil, errs.Mark(ErrInclude, "ERROR: include cycle: %s -> %s", strings.Join(cycle, " -> "), name)
+	}
+
+	content, err := options.Include(name)
+	if err != nil {
+		return nil, errs.Mark(ErrInclude, "ERROR: can't include %s: %w", name, err)
+	}
+	return &includedFile{name: name, reader: bufio.NewReader(bytes.NewReader(content))}, nil
+}
+
+// AnnotationError describes a line that looks like an annotation, but isn't
+// understood by ParseMigration, which ignores it.
+type AnnotationError struct {
+	Line    int
+	Message string
+}
+
+func (e *AnnotationError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+// The known commands and the options they take, nil when they take any.
+var commandOptions = map[string][]string{
+	"Up":             {optionNoTransaction},
+	"Down":           {optionNoTransaction, optionIrreversible},
+	"StatementBegin": {},
+	"StatementEnd":   {},
+	"Separator":      nil,
+	"Include":        nil,
+	"Squashes":       nil,
+	"Lint":           nil,
+}
+
+var misspelledCommandRegex = regexp.MustCompile(`(?i)^\s*--\s*(\+\s*migrate|migrate\s+(up|down|statementbegin|statementend|separator|include|squashes|lint)\b)`)
+
+// CheckAnnotations returns the annotations in a migration that are unknown or
+// misspelled.
+func CheckAnnotations(r io.Reader) ([]*AnnotationError, error) {
+	var errs []*AnnotationError
+
+	reader := bufio.NewReader(r)
+
+	lineNumber := 0
+	for {
+		line, ok, err := readLine(reader)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		lineNumber++
+
+		if strings.TrimSpace(line) == strings.TrimSpace(sqlCmdPrefix) {
+			errs = append(errs, &AnnotationError{Line: lineNumber, Message: "annotation without a command"})
+			continue
+		}
+
+		if !strings.HasPrefix(line, sqlCmdPrefix) {
+			if misspelledCommandRegex.MatchString(line) {
+				errs = append(errs, &AnnotationError{
+					Line:    lineNumber,
+					Message: fmt.Sprintf("misspelled annotation %q, annotations start with %q", strings.TrimSpace(line), sqlCmdPrefix),
+				})
+			}
+			continue
+		}
+
+		cmd, err := parseCommand(line)
+		if err != nil {
+			errs = append(errs, &AnnotationError{Line: lineNumber, Message: "annotation without a command"})
+			continue
+		}
+
+		options, ok := commandOptions[cmd.Command]
+		if !ok {
+			message := fmt.Sprintf("unknown annotation %q", cmd.Command)
+			for known := range commandOptions {
+				if strings.EqualFold(known, cmd.Command) {
+					message += fmt.Sprintf(", did you mean %q?", known)
+				}
+			}
+			errs = append(errs, &AnnotationError{Line: lineNumber, Message: message})
+			continue
+		}
+
+		if options != nil {
+			for _, opt := range cmd.Options {
+				if !slices.Contains(options, opt) {
+					errs = append(errs, &AnnotationError{
+						Line:    lineNumber,
+						Message: fmt.Sprintf("unknown option %q for %s", opt, cmd.Command),
+					})
+				}
+			}
+		}
+	}
+
+	return errs, nil
 }
@@ -1,6 +1,7 @@
 package sqlparse
 
 import (
+	"errors"
 	"strings"
 	"testing"
 
@@ -53,6 +54,237 @@ func (*SqlParseSuite) TestSemicolons(c *C) {
 	}
 }
 
+func (*SqlParseSuite) TestLexer(c *C) {
+	tests := []struct {
+		lines []string
+		ends  []bool
+	}{
+		{[]string{"SELECT 1;"}, []bool{true}},
+		{[]string{"SELECT 1; -- comment"}, []bool{true}},
+		{[]string{"SELECT 1; /* comment */"}, []bool{true}},
+		{[]string{"SELECT 1 -- comment ;"}, []bool{false}},
+		{[]string{"SELECT 'a;"}, []bool{false}},
+		{[]string{"SELECT 'it''s;", "';"}, []bool{false, true}},
+		{[]string{`SELECT E'\';`, "';"}, []bool{false, true}},
+		{[]string{`SELECT '\';`}, []bool{true}},
+		{[]string{`SELECT "a;`, `b";`}, []bool{false, true}},
+		{[]string{"SELECT `a;", "b`;"}, []bool{false, true}},
+		{[]string{"SELECT /* a;", "b; */ 1;"}, []bool{false, true}},
+		{[]string{"SELECT /* /* a */ ;", "*/ 1;"}, []bool{false, true}},
+		{[]string{"CREATE FUNCTION f() AS $$", "BEGIN;", "$$;"}, []bool{false, false, true}},
+		{[]string{"CREATE FUNCTION f() AS $body$", "SELECT $$;$$;", "$body$;"}, []bool{false, false, true}},
+		{[]string{"SELECT $1, a$b;"}, []bool{true}},
+		{[]string{"SELECT '--';"}, []bool{true}},
+	}
+
+	for _, test := range tests {
+		var l lexer
+		for i, line := range test.lines {
+			c.Assert(l.scanLine(line), Equals, test.ends[i], Commentf("%q", test.lines))
+		}
+	}
+}
+
+func (*SqlParseSuite) TestQuotedSemicolons(c *C) {
+	migration, err := ParseMigration(strings.NewReader(`-- +migrate Up
+INSERT INTO settings (value) VALUES ('a;
+-- not a comment
+b');
+CREATE FUNCTION f() RETURNS int AS $$
+BEGIN
+  RETURN 1;
+END;
+$$ LANGUAGE plpgsql;
+
+-- +migrate Down
+DROP FUNCTION f(); /* done;
+*/
+`))
+	c.Assert(err, IsNil)
+	c.Assert(migration.UpStatements, DeepEquals, []string{
+		"INSERT INTO settings (value) VALUES ('a;\n-- not a comment\nb');\n",
+		"CREATE FUNCTION f() RETURNS int AS $$\nBEGIN\n  RETURN 1;\nEND;\n$$ LANGUAGE plpgsql;\n",
+	})
+	c.Assert(migration.DownStatements, DeepEquals, []string{
+		"\nDROP FUNCTION f(); /* done;\n*/\n",
+	})
+
+	_, err = ParseMigration(strings.NewReader(`-- +migrate Up
+SELECT 'unterminated;
+`))
+	c.Assert(err, ErrorMatches, "ERROR: unterminated string literal")
+}
+
+func (*SqlParseSuite) TestBackslashEscapes(c *C) {
+	sql := `-- +migrate Up
+INSERT INTO t VALUES ('it\'s');
+INSERT INTO t VALUES ("say \"hi\";");
+`
+	_, err := ParseMigration(strings.NewReader(sql))
+	c.Assert(err, ErrorMatches, "ERROR: unterminated string literal")
+
+	migration, err := ParseMigrationWithOptions(strings.NewReader(sql), ParseOptions{BackslashEscapes: true})
+	c.Assert(err, IsNil)
+	c.Assert(migration.UpStatements, DeepEquals, []string{
+		"INSERT INTO t VALUES ('it\\'s');\n",
+		"INSERT INTO t VALUES (\"say \\\"hi\\\";\");\n",
+	})
+}
+
+func (*SqlParseSuite) TestHashComments(c *C) {
+	sql := `-- +migrate Up
+# don't do this
+CREATE TABLE a (id int); # it's done
+CREATE TABLE b (id int);
+`
+	migration, err := ParseMigrationWithOptions(strings.NewReader(sql), ParseOptions{BackslashEscapes: true})
+	c.Assert(err, IsNil)
+	c.Assert(migration.UpStatements, DeepEquals, []string{
+		"# don't do this\nCREATE TABLE a (id int); # it's done\n",
+		"CREATE TABLE b (id int);\n",
+	})
+
+	// # is an operator in PostgreSQL.
+	migration, err = ParseMigration(strings.NewReader("-- +migrate Up\nSELECT 5 # 3;\nSELECT 1;\n"))
+	c.Assert(err, IsNil)
+	c.Assert(migration.UpStatements, HasLen, 2)
+}
+
+func (*SqlParseSuite) TestLegacyStatementSplitting(c *C) {
+	LegacyStatementSplitting = true
+	defer func() { LegacyStatementSplitting = false }()
+
+	migration, err := ParseMigration(strings.NewReader(`-- +migrate Up
+INSERT INTO settings (value) VALUES ('a;
+b');
+`))
+	c.Assert(err, IsNil)
+	c.Assert(migration.UpStatements, DeepEquals, []string{
+		"INSERT INTO settings (value) VALUES ('a;\n",
+		"b');\n",
+	})
+}
+
+func (*SqlParseSuite) TestDelimiter(c *C) {
+	migration, err := ParseMigration(strings.NewReader(`-- +migrate Up
+CREATE TABLE people (id int);
+DELIMITER $$
+CREATE PROCEDURE count_people()
+BEGIN
+  SELECT COUNT(*) FROM people;
+END$$
+CREATE TRIGGER people_insert BEFORE INSERT ON people FOR EACH ROW
+BEGIN
+  SET NEW.id = NEW.id + 1;
+END $$ /* trigger */
+DELIMITER ;
+INSERT INTO people VALUES (1);
+
+-- +migrate Down
+delimiter //
+DROP PROCEDURE count_people //
+DROP TRIGGER people_insert//
+`))
+	c.Assert(err, IsNil)
+	c.Assert(migration.UpStatements, DeepEquals, []string{
+		"CREATE TABLE people (id int);\n",
+		"CREATE PROCEDURE count_people()\nBEGIN\n  SELECT COUNT(*) FROM people;\nEND\n",
+		"CREATE TRIGGER people_insert BEFORE INSERT ON people FOR EACH ROW\nBEGIN\n  SET NEW.id = NEW.id + 1;\nEND\n",
+		"INSERT INTO people VALUES (1);\n",
+	})
+	c.Assert(migration.DownStatements, DeepEquals, []string{
+		"\nDROP PROCEDURE count_people\n",
+		"DROP TRIGGER people_insert\n",
+	})
+
+	_, err = ParseMigration(strings.NewReader(`-- +migrate Up
+SELECT 1
+DELIMITER $$
+`))
+	c.Assert(err, ErrorMatches, "(?s)ERROR: The last statement must be ended by a semicolon.*")
+}
+
+func (*SqlParseSuite) TestStatementPositions(c *C) {
+	migration, err := ParseMigration(strings.NewReader(`-- +migrate Up
+-- A comment
+CREATE TABLE people (
+  id int
+);
+
+INSERT INTO people VALUES (1); -- +migrate is ignored here
+-- +migrate StatementBegin
+SELECT 1;
+SELECT 2;
+-- +migrate StatementEnd
+
+-- +migrate Down
+DROP TABLE people;
+`))
+	c.Assert(err, IsNil)
+	c.Assert(migration.UpPositions, DeepEquals, []StatementPosition{
+		{StartLine: 3, EndLine: 5},
+		{StartLine: 7, EndLine: 7},
+		{StartLine: 9, EndLine: 10},
+	})
+	c.Assert(migration.DownPositions, DeepEquals, []StatementPosition{
+		{StartLine: 14, EndLine: 14},
+	})
+}
+
+func (*SqlParseSuite) TestStreamMigration(c *C) {
+	values := strings.Repeat("(1),", 1024*1024) + "(1);"
+	parsed, statements := StreamMigration(strings.NewReader(`-- +migrate Up notransaction
+-- +migrate Squashes 1_a.sql
+CREATE TABLE numbers (n int);
+INSERT INTO numbers VALUES `+values+`
+
+-- +migrate Down
+DROP TABLE numbers;
+`), ParseOptions{})
+
+	var found []Statement
+	for stmt, err := range statements {
+		c.Assert(err, IsNil)
+		found = append(found, stmt)
+	}
+	c.Assert(found, HasLen, 3)
+	c.Assert(found[0], DeepEquals, Statement{
+		SQL:                "CREATE TABLE numbers (n int);\n",
+		Position:           StatementPosition{StartLine: 3, EndLine: 3},
+		DisableTransaction: true,
+	})
+	c.Assert(found[1].SQL, Equals, "INSERT INTO numbers VALUES "+values+"\n")
+	c.Assert(found[2], DeepEquals, Statement{
+		SQL:      "\nDROP TABLE numbers;\n",
+		Position: StatementPosition{StartLine: 7, EndLine: 7},
+		Down:     true,
+	})
+	c.Assert(parsed.DisableTransactionUp, Equals, true)
+	c.Assert(parsed.Squashes, DeepEquals, []string{"1_a.sql"})
+	c.Assert(parsed.HasDown, Equals, true)
+	c.Assert(parsed.UpStatements, HasLen, 0)
+
+	// Errors end the statements.
+	_, statements = StreamMigration(strings.NewReader("-- +migrate Up\nSELECT 1;\nSELECT 'unterminated;\n"), ParseOptions{})
+	var errs []error
+	for stmt, err := range statements {
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			c.Assert(stmt.SQL, Equals, "SELECT 1;\n")
+		}
+	}
+	c.Assert(errs, HasLen, 1)
+	c.Assert(errs[0], ErrorMatches, "ERROR: unterminated string literal")
+
+	// Stopping early doesn't read the rest.
+	_, statements = StreamMigration(strings.NewReader("-- +migrate Up\nSELECT 1;\nSELECT 'unterminated;\n"), ParseOptions{})
+	for _, err := range statements {
+		c.Assert(err, IsNil)
+		break
+	}
+}
+
 func (*SqlParseSuite) TestSplitStatements(c *C) {
 	type testData struct {
 		sql       string
@@ -126,6 +358,243 @@ func (*SqlParseSuite) TestCustomTerminator(c *C) {
 	}
 }
 
+func (*SqlParseSuite) TestParseOptions(c *C) {
+	migration, err := ParseMigrationWithOptions(strings.NewReader(multitxtSplitByGO), ParseOptions{Separator: "GO"})
+	c.Assert(err, IsNil)
+	c.Assert(migration.UpStatements, HasLen, 2)
+	c.Assert(migration.DownStatements, HasLen, 2)
+
+	// The package variable isn't touched.
+	_, err = ParseMigration(strings.NewReader(multitxtSplitByGO))
+	c.Assert(err, NotNil)
+}
+
+func (*SqlParseSuite) TestSeparatorAnnotation(c *C) {
+	migration, err := ParseMigration(strings.NewReader(`-- +migrate Separator GO
+-- +migrate Up
+CREATE TABLE people (id int)
+GO
+INSERT INTO people VALUES (1)
+GO 3
+SELECT 1;
+GO
+SELECT 2;
+GO 2
+
+-- +migrate Down
+DROP TABLE people
+GO
+`))
+	c.Assert(err, IsNil)
+	c.Assert(migration.UpStatements, DeepEquals, []string{
+		"CREATE TABLE people (id int)\n",
+		"INSERT INTO people VALUES (1)\n",
+		"INSERT INTO people VALUES (1)\n",
+		"INSERT INTO people VALUES (1)\n",
+		"SELECT 1;\n",
+		"SELECT 2;\n",
+		"SELECT 2;\n",
+	})
+	c.Assert(migration.DownStatements, DeepEquals, []string{
+		"\nDROP TABLE people\n",
+	})
+
+	_, err = ParseMigration(strings.NewReader("-- +migrate Separator\n-- +migrate Up\nSELECT 1;\n"))
+	c.Assert(err, ErrorMatches, "ERROR: '-- \\+migrate Separator' needs a single line to separate statements by")
+}
+
+func (*SqlParseSuite) TestPlsqlBlocks(c *C) {
+	migration, err := ParseMigrationWithOptions(strings.NewReader(`-- +migrate Up
+CREATE TABLE people (id NUMBER);
+/
+CREATE OR REPLACE PROCEDURE add_person(p_id NUMBER) AS
+BEGIN
+  INSERT INTO people VALUES (p_id);
+END;
+/
+BEGIN
+  add_person(1);
+END;
+/
+
+-- +migrate Down
+DROP PROCEDURE add_person;
+DROP TABLE people;
+`), ParseOptions{Separator: "/"})
+	c.Assert(err, IsNil)
+	c.Assert(migration.UpStatements, DeepEquals, []string{
+		"CREATE TABLE people (id NUMBER);\n",
+		"CREATE OR REPLACE PROCEDURE add_person(p_id NUMBER) AS\nBEGIN\n  INSERT INTO people VALUES (p_id);\nEND;\n",
+		"BEGIN\n  add_person(1);\nEND;\n",
+	})
+	c.Assert(migration.DownStatements, DeepEquals, []string{
+		"\nDROP PROCEDURE add_person;\n",
+		"DROP TABLE people;\n",
+	})
+	c.Assert(migration.UpBlocks, DeepEquals, []bool{false, true, true})
+	c.Assert(migration.DownBlocks, DeepEquals, []bool{false, false})
+}
+
+func (*SqlParseSuite) TestInclude(c *C) {
+	fragments := map[string]string{
+		"_fragments/grants.sql": "GRANT SELECT ON people TO reader;\n-- +migrate Include _fragments/admin.sql\n",
+		"_fragments/admin.sql":  "GRANT ALL ON people TO admin;\n",
+		"_fragments/loop.sql":   "-- +migrate Include _fragments/./cycle.sql\n",
+		"_fragments/cycle.sql":  "-- +migrate Include _fragments/loop.sql\n",
+	}
+	options := ParseOptions{
+		Include: func(name string) ([]byte, error) {
+			content, ok := fragments[name]
+			if !ok {
+				return nil, errors.New("not found")
+			}
+			return []byte(content), nil
+		},
+	}
+
+	migration, err := ParseMigrationWithOptions(strings.NewReader(`-- +migrate Up
+CREATE TABLE people (id int);
+-- +migrate Include _fragments/grants.sql
+SELECT 1;
+`), options)
+	c.Assert(err, IsNil)
+	c.Assert(migration.UpStatements, DeepEquals, []string{
+		"CREATE TABLE people (id int);\n",
+		"GRANT SELECT ON people TO reader;\n",
+		"GRANT ALL ON people TO admin;\n",
+		"SELECT 1;\n",
+	})
+	c.Assert(migration.UpPositions, DeepEquals, []StatementPosition{
+		{StartLine: 2, EndLine: 2},
+		{StartLine: 3, EndLine: 3},
+		{StartLine: 3, EndLine: 3},
+		{StartLine: 4, EndLine: 4},
+	})
+
+	_, err = ParseMigrationWithOptions(strings.NewReader("-- +migrate Up\n-- +migrate Include _fragments/loop.sql\n"), options)
+	c.Assert(err, ErrorMatches, "ERROR: include cycle: _fragments/loop.sql -> _fragments/cycle.sql -> _fragments/loop.sql")
+
+	_, err = ParseMigrationWithOptions(strings.NewReader("-- +migrate Up\n-- +migrate Include missing.sql\n"), options)
+	c.Assert(err, ErrorMatches, "ERROR: can't include missing.sql: not found")
+
+	_, err = ParseMigration(strings.NewReader("-- +migrate Up\n-- +migrate Include _fragments/admin.sql\n"))
+	c.Assert(err, ErrorMatches, "ERROR: can't include _fragments/admin.sql, includes aren't supported here")
+}
+
+func (*SqlParseSuite) TestErrors(c *C) {
+	tests := map[string]error{
+		"SELECT 1;\n":                                   ErrNoAnnotations,
+		"-- +migrate Up\nSELECT 1\n":                    ErrNoTerminator,
+		"-- +migrate Up\nSELECT /* 1;\n":                ErrUnterminated,
+		"-- +migrate Up\n-- +migrate StatementBegin\n":  ErrUnmatchedStatementBegin,
+		"-- +migrate Up\n-- +migrate Lint nope\n":       ErrInvalidAnnotation,
+		"-- +migrate Up\n-- +migrate Include a.sql\n":   ErrInclude,
+		"-- +migrate Up\n-- +migrate Separator a b\n":   ErrInvalidAnnotation,
+		"-- +migrate Up\n-- +migrate Include a.sql b\n": ErrInvalidAnnotation,
+	}
+	for sql, sentinel := range tests {
+		_, err := ParseMigration(strings.NewReader(sql))
+		c.Assert(errors.Is(err, sentinel), Equals, true, Commentf("%q: %v", sql, err))
+	}
+}
+
+func (*SqlParseSuite) TestSquashes(c *C) {
+	migration, err := ParseMigration(strings.NewReader(`-- +migrate Squashes 1_initial.sql
+-- +migrate Squashes 2_record.sql 3_other.sql
+-- +migrate Up
+CREATE TABLE people (id int);
+
+-- +migrate Down
+`))
+	c.Assert(err, IsNil)
+	c.Assert(migration.Squashes, DeepEquals, []string{"1_initial.sql", "2_record.sql", "3_other.sql"})
+	c.Assert(migration.UpStatements, HasLen, 1)
+	c.Assert(migration.HasDown, Equals, true)
+}
+
+func (*SqlParseSuite) TestLintIgnore(c *C) {
+	migration, err := ParseMigration(strings.NewReader(`-- +migrate Lint ignore=drop-table
+-- +migrate Lint ignore=drop-column,update-without-where
+-- +migrate Up
+DROP TABLE people;
+`))
+	c.Assert(err, IsNil)
+	c.Assert(migration.LintIgnore, DeepEquals, []string{"drop-table", "drop-column", "update-without-where"})
+	c.Assert(migration.HasDown, Equals, false)
+
+	_, err = ParseMigration(strings.NewReader(`-- +migrate Lint drop-table
+-- +migrate Up
+DROP TABLE people;
+`))
+	c.Assert(err, ErrorMatches, `ERROR: unknown Lint option "drop-table"`)
+
+	_, err = ParseMigration(strings.NewReader(`-- +migrate Lint ignore=
+-- +migrate Up
+DROP TABLE people;
+`))
+	c.Assert(err, ErrorMatches, `ERROR: missing rule name in Lint option "ignore="`)
+	c.Assert(errors.Is(err, ErrInvalidAnnotation), Equals, true)
+}
+
+func (*SqlParseSuite) TestIrreversible(c *C) {
+	migration, err := ParseMigration(strings.NewReader(`-- +migrate Up
+DROP TABLE people;
+
+-- +migrate Down irreversible
+-- the data is gone
+`))
+	c.Assert(err, IsNil)
+	c.Assert(migration.Irreversible, Equals, true)
+	c.Assert(migration.HasDown, Equals, true)
+
+	_, err = ParseMigration(strings.NewReader(`-- +migrate Up
+DROP TABLE people;
+
+-- +migrate Down irreversible
+CREATE TABLE people (id int);
+`))
+	c.Assert(errors.Is(err, ErrInvalidAnnotation), Equals, true)
+	c.Assert(err, ErrorMatches, `ERROR: the Down section of an irreversible migration can't have statements \(line 5\)`)
+}
+
+func (*SqlParseSuite) TestCheckAnnotations(c *C) {
+	errs, err := CheckAnnotations(strings.NewReader(`-- +migrate Up notransaction
+--+migrate StatementBegin
+CREATE TABLE people (id int);
+-- +migrate statementEnd
+-- migrate the people table
+
+-- +migrate Down notransactions
+-- +migrate
+DROP TABLE people;
+`))
+	c.Assert(err, IsNil)
+
+	var found []string
+	for _, e := range errs {
+		found = append(found, e.Error())
+	}
+	c.Assert(found, DeepEquals, []string{
+		`line 2: misspelled annotation "--+migrate StatementBegin", annotations start with "-- +migrate "`,
+		`line 4: unknown annotation "statementEnd", did you mean "StatementEnd"?`,
+		`line 7: unknown option "notransactions" for Down`,
+		`line 8: annotation without a command`,
+	})
+}
+
+func (*SqlParseSuite) TestCheckAnnotationsLongLines(c *C) {
+	// Longer than a bufio.Scanner accepts.
+	long := "INSERT INTO blobs VALUES ('" + strings.Repeat("x", 2<<20) + "');\n"
+	errs, err := CheckAnnotations(strings.NewReader("-- +migrate Up\n" + long + "-- +migrate statementEnd\n"))
+	c.Assert(err, IsNil)
+	c.Assert(errs, HasLen, 1)
+	c.Assert(errs[0].Error(), Equals, `line 3: unknown annotation "statementEnd", did you mean "StatementEnd"?`)
+
+	migration, err := ParseMigrationWithOptions(strings.NewReader("-- +migrate Up\n"+long), ParseOptions{LegacyStatementSplitting: true})
+	c.Assert(err, IsNil)
+	c.Assert(migration.UpStatements, DeepEquals, []string{long})
+}
+
 var functxt = `-- +migrate Up
 CREATE TABLE IF NOT EXISTS histories (
   id                BIGSERIAL  PRIMARY KEY,
@@ -0,0 +1,172 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MigrationStatus is the state of a single migration, see StatusReport.
+type MigrationStatus struct {
+	Id string
+
+	// Migration is nil for unknown migrations.
+	Migration *Migration
+
+	Applied   bool
+	AppliedAt time.Time
+
+	// Unknown is set for applied migrations that aren't in the migration
+	// source, eg: because their file was removed.
+	Unknown bool
+
+	// OutOfOrder is set for pending migrations that sort before an applied
+	// migration, so they'd be applied out of order.
+	OutOfOrder bool
+
+	// Drifted is set for applied migrations that were changed after they were
+	// applied. It's only known for migrations applied by a version of
+	// sql-migrate that records checksums.
+	Drifted bool
+
+	// NoTransaction is set when the Up migration doesn't run in a transaction.
+	NoTransaction bool
+
+	// HasDown is set when the migration has Down statements.
+	HasDown bool
+}
+
+// Pending tells whether the migration still has to be applied.
+func (s *MigrationStatus) Pending() bool {
+	return !s.Applied
+}
+
+// StatusReport is the state of all migrations, see MigrationSet.Status.
+type StatusReport struct {
+	// Migrations are in the order of the migration source, followed by the
+	// unknown migrations in the order they were applied.
+	Migrations []*MigrationStatus
+}
+
+// Pending returns the migrations that still have to be applied.
+func (r *StatusReport) Pending() []*MigrationStatus {
+	var pending []*MigrationStatus
+	for _, m := range r.Migrations {
+		if m.Pending() {
+			pending = append(pending, m)
+		}
+	}
+	return pending
+}
+
+// Check returns an error when migrations are pending, unknown, out of order or
+// changed after they were applied. It matches ErrPendingMigration,
+// ErrUnknownMigration, ErrOutOfOrder or ErrMigrationChanged with errors.Is.
+//
+// Services can use it to refuse to start when the schema is behind.
+func (r *StatusReport) Check() error {
+	var errs []error
+	for _, m := range r.Migrations {
+		switch {
+		case m.Unknown:
+			errs = append(errs, fmt.Errorf("%s: %w", m.Id, ErrUnknownMigration))
+		case m.Drifted:
+			errs = append(errs, fmt.Errorf("%s: %w", m.Id, ErrMigrationChanged))
+		case m.OutOfOrder:
+			errs = append(errs, fmt.Errorf("%s: %w", m.Id, ErrOutOfOrder))
+		case m.Pending():
+			errs = append(errs, fmt.Errorf("%s: %w", m.Id, ErrPendingMigration))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Status returns the state of each migration in the database.
+func Status(ctx context.Context, db *sql.DB, dialect string, m MigrationSource) (*StatusReport, error) {
+	return migSet.Status(ctx, db, dialect, m)
+}
+
+// Status returns the state of each migration in the database. Applied
+// migrations that aren't in the migration source are left out when
+// IgnoreUnknown is set.
+func (ms MigrationSet) Status(ctx context.Context, db *sql.DB, dialect string, m MigrationSource) (*StatusReport, error) {
+	dbMap, err := ms.getMigrationDbMap(db, dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := m.FindMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var records []MigrationRecord
+	if exists, err := ms.hasMigrationTable(dbMap); err != nil {
+		return nil, err
+	} else if exists {
+		_, err = dbMap.WithContext(ctx).Select(&records, fmt.Sprintf("SELECT * FROM %s ORDER BY %s",
+			dbMap.Dialect.QuotedTableForQuery(ms.SchemaName, ms.getTableName()),
+			dbMap.Dialect.QuoteField("applied_at")))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	migrations, records, err = resolveSquashedMigrations(migrations, records)
+	if err != nil {
+		return nil, err
+	}
+
+	checksums, err := ms.getChecksums(dbMap)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[string]MigrationRecord)
+	for _, record := range records {
+		applied[record.Id] = record
+	}
+
+	report := &StatusReport{}
+	byId := make(map[string]bool)
+	lastApplied := -1
+	for i, migration := range migrations {
+		byId[migration.Id] = true
+		status := &MigrationStatus{
+			Id:            migration.Id,
+			Migration:     migration,
+			NoTransaction: migration.DisableTransactionUp,
+			HasDown:       migration.hasDown(),
+		}
+		if record, ok := applied[migration.Id]; ok {
+			status.Applied = true
+			status.AppliedAt = record.AppliedAt
+			lastApplied = i
+			if checksum, ok := checksums[migration.Id]; ok && checksum != migration.Checksum() {
+				status.Drifted = true
+			}
+		}
+		report.Migrations = append(report.Migrations, status)
+	}
+
+	for i, status := range report.Migrations {
+		status.OutOfOrder = i < lastApplied && !status.Applied
+	}
+
+	if !ms.IgnoreUnknown {
+		for _, record := range records {
+			if !byId[record.Id] {
+				report.Migrations = append(report.Migrations, &MigrationStatus{
+					Id:        record.Id,
+					Applied:   true,
+					AppliedAt: record.AppliedAt,
+					Unknown:   true,
+				})
+			}
+		}
+	}
+
+	return report, nil
+}
@@ -0,0 +1,127 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+)
+
+type StatusSuite struct {
+	Db *sql.DB
+}
+
+var _ = Suite(&StatusSuite{})
+
+func (s *StatusSuite) SetUpTest(c *C) {
+	var err error
+	s.Db, err = sql.Open("sqlite3", ":memory:")
+	c.Assert(err, IsNil)
+}
+
+func (s *StatusSuite) TearDownTest(c *C) {
+	c.Assert(s.Db.Close(), IsNil)
+}
+
+var statusMigrations = []*Migration{
+	{Id: "1_people.sql", Up: []string{"CREATE TABLE people (id int)"}, Down: []string{"DROP TABLE people"}},
+	{Id: "2_pets.sql", Up: []string{"CREATE TABLE pets (id int)"}},
+	{Id: "3_cars.sql", Up: []string{"CREATE TABLE cars (id int)"}, DisableTransactionUp: true},
+}
+
+func (s *StatusSuite) TestStatus(c *C) {
+	_, err := Exec(s.Db, "sqlite3", &MemoryMigrationSource{Migrations: statusMigrations[:1]}, Up)
+	c.Assert(err, IsNil)
+
+	report, err := Status(context.Background(), s.Db, "sqlite3", &MemoryMigrationSource{Migrations: statusMigrations})
+	c.Assert(err, IsNil)
+	c.Assert(report.Migrations, HasLen, 3)
+
+	c.Assert(report.Migrations[0].Applied, Equals, true)
+	c.Assert(report.Migrations[0].AppliedAt.IsZero(), Equals, false)
+	c.Assert(report.Migrations[0].HasDown, Equals, true)
+	c.Assert(report.Migrations[0].Drifted, Equals, false)
+	c.Assert(report.Migrations[1].Pending(), Equals, true)
+	c.Assert(report.Migrations[1].HasDown, Equals, false)
+	c.Assert(report.Migrations[2].NoTransaction, Equals, true)
+	c.Assert(report.Pending(), HasLen, 2)
+
+	err = report.Check()
+	c.Assert(errors.Is(err, ErrPendingMigration), Equals, true)
+	c.Assert(errors.Is(err, ErrOutOfOrder), Equals, false)
+
+	_, err = Exec(s.Db, "sqlite3", &MemoryMigrationSource{Migrations: statusMigrations}, Up)
+	c.Assert(err, IsNil)
+
+	report, err = Status(context.Background(), s.Db, "sqlite3", &MemoryMigrationSource{Migrations: statusMigrations})
+	c.Assert(err, IsNil)
+	c.Assert(report.Pending(), HasLen, 0)
+	c.Assert(report.Check(), IsNil)
+}
+
+func (s *StatusSuite) TestInconsistent(c *C) {
+	_, err := Exec(s.Db, "sqlite3", &MemoryMigrationSource{Migrations: []*Migration{
+		statusMigrations[0],
+		statusMigrations[2],
+		{Id: "4_gone.sql", Up: []string{"SELECT 1"}},
+	}}, Up)
+	c.Assert(err, IsNil)
+
+	changed := *statusMigrations[0]
+	changed.Up = []string{"CREATE TABLE people (id int, name text)"}
+	migrations := &MemoryMigrationSource{Migrations: []*Migration{&changed, statusMigrations[1], statusMigrations[2]}}
+
+	report, err := Status(context.Background(), s.Db, "sqlite3", migrations)
+	c.Assert(err, IsNil)
+	c.Assert(report.Migrations, HasLen, 4)
+	c.Assert(report.Migrations[0].Drifted, Equals, true)
+	c.Assert(report.Migrations[1].OutOfOrder, Equals, true)
+	c.Assert(report.Migrations[2].OutOfOrder, Equals, false)
+	c.Assert(report.Migrations[3].Id, Equals, "4_gone.sql")
+	c.Assert(report.Migrations[3].Unknown, Equals, true)
+	c.Assert(report.Migrations[3].Migration, IsNil)
+
+	err = report.Check()
+	for _, sentinel := range []error{ErrMigrationChanged, ErrOutOfOrder, ErrUnknownMigration} {
+		c.Assert(errors.Is(err, sentinel), Equals, true)
+	}
+
+	ms := MigrationSet{IgnoreUnknown: true}
+	report, err = ms.Status(context.Background(), s.Db, "sqlite3", migrations)
+	c.Assert(err, IsNil)
+	c.Assert(report.Migrations, HasLen, 3)
+}
+
+func (s *StatusSuite) TestChecksumsRemovedOnDown(c *C) {
+	migrations := &MemoryMigrationSource{Migrations: statusMigrations[:1]}
+	_, err := Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+
+	dbMap, err := migSet.getMigrationDbMap(s.Db, "sqlite3")
+	c.Assert(err, IsNil)
+	checksums, err := migSet.getChecksums(dbMap)
+	c.Assert(err, IsNil)
+	c.Assert(checksums, DeepEquals, map[string]string{"1_people.sql": statusMigrations[0].Checksum()})
+
+	_, err = Exec(s.Db, "sqlite3", migrations, Down)
+	c.Assert(err, IsNil)
+	checksums, err = migSet.getChecksums(dbMap)
+	c.Assert(err, IsNil)
+	c.Assert(checksums, HasLen, 0)
+}
+
+func (s *StatusSuite) TestWithoutChecksumTable(c *C) {
+	_, err := s.Db.Exec("CREATE TABLE gorp_migrations (id text primary key, applied_at datetime)")
+	c.Assert(err, IsNil)
+
+	ms := MigrationSet{DisableCreateTable: true}
+	migrations := &MemoryMigrationSource{Migrations: statusMigrations[:1]}
+	_, err = ms.Exec(s.Db, "sqlite3", migrations, Up)
+	c.Assert(err, IsNil)
+
+	report, err := ms.Status(context.Background(), s.Db, "sqlite3", migrations)
+	c.Assert(err, IsNil)
+	c.Assert(report.Check(), IsNil)
+}
@@ -0,0 +1,150 @@
+package migrate
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/rubenv/sql-migrate/sqlparse"
+)
+
+// ValidationProblem is something wrong with a migration file.
+type ValidationProblem struct {
+	File string `json:"file" yaml:"file"`
+	// Line is 0 when the problem concerns the whole file.
+	Line    int    `json:"line,omitempty" yaml:"line,omitempty"`
+	Message string `json:"message" yaml:"message"`
+}
+
+func (p ValidationProblem) String() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("%s: %s", p.File, p.Message)
+	}
+	return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Message)
+}
+
+// ValidationReport is the result of validating a directory of migrations.
+type ValidationReport struct {
+	// Migrations is the number of migrations found.
+	Migrations int                 `json:"migrations" yaml:"migrations"`
+	Problems   []ValidationProblem `json:"problems" yaml:"problems"`
+}
+
+// Valid returns whether no problems were found.
+func (r *ValidationReport) Valid() bool {
+	return len(r.Problems) == 0
+}
+
+func (r *ValidationReport) add(file string, line int, format string, args ...interface{}) {
+	r.Problems = append(r.Problems, ValidationProblem{
+		File:    file,
+		Line:    line,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+// ValidateMigrations checks a directory of migrations without connecting to a
+// database. It reports files that don't parse, unknown or misspelled
+// annotations, migrations without Up statements, migrations sharing a version
+// number, migrations whose order depends on sorting by number rather than as
+// text, and files that look like migrations but are ignored because they don't
+// end in .sql.
+//
+// The migrations are read from the root directory in fsys, eg: an embed.FS.
+// For a directory on disk, use:
+//
+//	report, err := migrate.ValidateMigrations(os.DirFS("migrations"), ".")
+func ValidateMigrations(fsys fs.FS, root string) (*ValidationReport, error) {
+	return FSMigrationSource{FileSystem: fsys, Root: root}.Validate()
+}
+
+// Validate checks the migrations in the directory like ValidateMigrations,
+// including subdirectories when Recursive is set.
+func (f FileMigrationSource) Validate() (*ValidationReport, error) {
+	return f.fsSource().Validate()
+}
+
+// Validate checks the migrations like ValidateMigrations, including
+// subdirectories when Recursive is set.
+func (f FSMigrationSource) Validate() (*ValidationReport, error) {
+	report := &ValidationReport{
+		Problems: make([]ValidationProblem, 0),
+	}
+
+	files, err := f.walk()
+	if err != nil {
+		return nil, err
+	}
+
+	migrations := make([]*Migration, 0)
+	ids := make(map[string]string)
+	for _, file := range files {
+		name := file.Id
+		if !file.isMigration() {
+			if strings.EqualFold(path.Ext(name), ".sql") || numberPrefixRegex.MatchString(path.Base(name)) {
+				report.add(name, 0, "looks like a migration, but is ignored because its name doesn't end in .sql")
+			}
+			continue
+		}
+
+		if other, ok := ids[name]; ok {
+			report.add(file.Rel, 0, "has the same id as %s", other)
+			continue
+		}
+		ids[name] = file.Rel
+
+		content, err := fs.ReadFile(f.FileSystem, file.Path)
+		if err != nil {
+			return nil, err
+		}
+
+		annotationErrors, err := sqlparse.CheckAnnotations(bytes.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range annotationErrors {
+			report.add(name, e.Line, "%s", e.Message)
+		}
+
+		migration, err := ParseMigrationWithOptions(name, bytes.NewReader(content), f.parseOptions())
+		if err != nil {
+			report.add(name, 0, "%s", err)
+			continue
+		}
+		if len(migration.Up) == 0 {
+			report.add(name, 0, "has no Up statements")
+		}
+		migrations = append(migrations, migration)
+	}
+
+	sort.Sort(byId(migrations))
+	report.Migrations = len(migrations)
+
+	versions := make(map[int64]string)
+	for _, m := range migrations {
+		v, err := m.Version()
+		if err != nil {
+			continue
+		}
+		if other, ok := versions[v]; ok {
+			report.add(m.Id, 0, "has the same version %d as %s", v, other)
+			continue
+		}
+		versions[v] = m.Id
+	}
+
+	// Other tools, like ls, sort the files as text.
+	for i, m := range migrations {
+		for _, earlier := range migrations[:i] {
+			if path.Base(earlier.Id) > path.Base(m.Id) {
+				report.add(m.Id, 0, "sorts before %s as text, but after it by number, pad the numbers with zeros", earlier.Id)
+				break
+			}
+		}
+	}
+
+	return report, nil
+}
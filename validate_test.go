@@ -0,0 +1,63 @@
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+
+	//revive:disable-next-line:dot-imports
+	. "gopkg.in/check.v1"
+)
+
+type ValidateSuite struct{}
+
+var _ = Suite(&ValidateSuite{})
+
+func (*ValidateSuite) validate(c *C, files map[string]string) *ValidationReport {
+	dir := c.MkDir()
+	for name, content := range files {
+		c.Assert(os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600), IsNil)
+	}
+	c.Assert(os.Mkdir(filepath.Join(dir, "_archive"), 0o755), IsNil)
+
+	report, err := ValidateMigrations(os.DirFS(dir), ".")
+	c.Assert(err, IsNil)
+	return report
+}
+
+func (s *ValidateSuite) TestValid(c *C) {
+	report, err := ValidateMigrations(os.DirFS("test-migrations"), ".")
+	c.Assert(err, IsNil)
+	c.Assert(report.Valid(), Equals, true)
+	c.Assert(report.Migrations, Equals, 2)
+}
+
+func (s *ValidateSuite) TestProblems(c *C) {
+	report := s.validate(c, map[string]string{
+		"1_initial.sql":  "-- +migrate Up\nCREATE TABLE people (id int);\n-- +migrate Down\nDROP TABLE people;\n",
+		"2_first.sql":    "-- +migrate Up\nSELECT 1;\n",
+		"2_second.sql":   "-- +migrate Up\nSELECT 2;\n",
+		"3_empty.sql":    "-- +migrate Up\n-- +migrate Down\nSELECT 3;\n",
+		"4_typo.sql":     "-- +migrate Up\nSELECT 4;\n-- +migrate down\n",
+		"5_broken.sql":   "SELECT 5;\n",
+		"10_later.sql":   "-- +migrate Up\nSELECT 10;\n",
+		"11_upper.SQL":   "-- +migrate Up\nSELECT 11;\n",
+		"12_missing.txt": "-- +migrate Up\nSELECT 12;\n",
+		"README.md":      "Migrations",
+	})
+
+	var found []string
+	for _, p := range report.Problems {
+		found = append(found, p.String())
+	}
+	c.Assert(found, DeepEquals, []string{
+		"11_upper.SQL: looks like a migration, but is ignored because its name doesn't end in .sql",
+		"12_missing.txt: looks like a migration, but is ignored because its name doesn't end in .sql",
+		"3_empty.sql: has no Up statements",
+		`4_typo.sql:3: unknown annotation "down", did you mean "Down"?`,
+		"5_broken.sql: Error parsing migration (5_broken.sql): ERROR: no Up/Down annotations found, so no statements were executed.\n\t\t\tSee https://github.com/rubenv/sql-migrate for details.",
+		"2_second.sql: has the same version 2 as 2_first.sql",
+		"10_later.sql: sorts before 1_initial.sql as text, but after it by number, pad the numbers with zeros",
+	})
+	c.Assert(report.Migrations, Equals, 6)
+	c.Assert(report.Valid(), Equals, false)
+}